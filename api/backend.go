@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"errors"
+)
+
+// VaultBackend is the set of vault operations used by the MCP tools.
+// ObsidianAPI implements it on top of the Local REST API plugin and
+// FileSystemVault implements it directly on a vault directory. Every
+// operation stops when its context is cancelled.
+type VaultBackend interface {
+	// GetNote retrieves the content of a note by its path
+	GetNote(ctx context.Context, path string) (string, error)
+	// CreateNote creates a new note
+	CreateNote(ctx context.Context, path, content string) (string, error)
+	// UpdateNote updates an existing note
+	UpdateNote(ctx context.Context, path, content string) (string, error)
+	// AppendNote appends content to the end of a note
+	AppendNote(ctx context.Context, path, content string) (string, error)
+	// PatchNote edits the section of a note below a heading, a block
+	// reference or a frontmatter key
+	PatchNote(ctx context.Context, path string, patch Patch) (string, error)
+	// DeleteNote deletes a note
+	DeleteNote(ctx context.Context, path string) (string, error)
+	// MoveNote moves a note to a new path without touching links
+	MoveNote(ctx context.Context, from, to string) (string, error)
+	// ListNotes lists the notes in the vault root or a specific folder
+	ListNotes(ctx context.Context, folder string) ([]string, error)
+	// ListEntries lists the folders, notes and, if asked for, attachments
+	// in the vault root or a folder, skipping hidden ones
+	ListEntries(ctx context.Context, folder string, opts ListOptions) ([]Entry, error)
+	// ListAllNotes lists the paths of every note in the vault
+	ListAllNotes(ctx context.Context) ([]string, error)
+	// GetVaultInfo gets information about the vault
+	GetVaultInfo(ctx context.Context) (VaultInfo, error)
+}
+
+// ModTimeLister is implemented by backends that can list when each note
+// was last modified, so changed notes can be found without reading them.
+// A modification time of 0 means it is unknown.
+type ModTimeLister interface {
+	NoteModTimes(ctx context.Context) (map[string]int64, error)
+}
+
+// QueryRunner is implemented by backends that run the query languages of
+// Obsidian plugins: Dataview DQL and JsonLogic
+type QueryRunner interface {
+	QueryDataview(ctx context.Context, query string) ([]QueryRow, error)
+	QueryJSONLogic(ctx context.Context, logic string) ([]QueryRow, error)
+}
+
+// Backend names accepted in the configuration
+const (
+	BackendREST       = "rest"
+	BackendFileSystem = "filesystem"
+)
+
+var (
+	_ VaultBackend = (*ObsidianAPI)(nil)
+	_ VaultBackend = (*FileSystemVault)(nil)
+	_ Watcher      = (*ObsidianAPI)(nil)
+	_ Watcher      = (*FileSystemVault)(nil)
+
+	_ ModTimeLister = (*ObsidianAPI)(nil)
+	_ ModTimeLister = (*FileSystemVault)(nil)
+
+	_ Querier     = (*IndexedVault)(nil)
+	_ QueryRunner = (*ObsidianAPI)(nil)
+)
+
+// Unwrap returns the backend that vault wraps, such as the backend below
+// an IndexedVault, or vault itself if it wraps none
+func Unwrap(vault VaultBackend) VaultBackend {
+	for {
+		wrapper, ok := vault.(interface{ Unwrap() VaultBackend })
+		if !ok {
+			return vault
+		}
+		vault = wrapper.Unwrap()
+	}
+}
+
+// NoteExists reports whether a note exists in a vault
+func NoteExists(ctx context.Context, vault VaultBackend, path string) (bool, error) {
+	_, err := vault.GetNote(ctx, path)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, ErrNotFound):
+		return false, nil
+	default:
+		return false, err
+	}
+}
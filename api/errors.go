@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+)
+
+// Typed errors returned by backends. Errors wrap them with %w, so callers
+// can check the kind of failure with errors.Is.
+var (
+	// ErrNotFound is returned when a note or folder does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyExists is returned when a note would overwrite another
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrUnauthorized is returned when Obsidian rejects the API token
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrConflict is returned when a note changed in a way that prevents
+	// the operation
+	ErrConflict = errors.New("conflict")
+	// ErrInvalidArgument is returned when a request is malformed, such as
+	// a patch with an unknown operation
+	ErrInvalidArgument = errors.New("invalid argument")
+	// ErrCanceled is returned when an operation stops because its context
+	// was cancelled, for example when the MCP client cancels a tool call
+	ErrCanceled = errors.New("operation cancelled")
+	// ErrTimeout is returned when a request or a whole operation exceeds
+	// its time limit
+	ErrTimeout = errors.New("operation timed out")
+	// ErrUnavailable is returned when Obsidian can't be reached, and
+	// without contacting it while the circuit breaker is open after
+	// repeated failures
+	ErrUnavailable = errors.New("Obsidian unreachable")
+	// ErrCertificate is returned when the server certificate is not
+	// trusted. Requests failing with it are not retried, since retrying
+	// cannot help.
+	ErrCertificate = errors.New("untrusted server certificate")
+)
+
+// contextError returns ErrCanceled or ErrTimeout once ctx is done, and nil
+// while it is still active
+func contextError(ctx context.Context) error {
+	switch ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return ErrTimeout
+	default:
+		return ErrCanceled
+	}
+}
+
+// kindError attaches a typed error to an error without changing its message
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string   { return e.err.Error() }
+func (e *kindError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// statusError describes an unexpected response status of the Local REST
+// API, typed by what the status means
+func statusError(resp *http.Response) error {
+	err := errors.New(resp.Status)
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return &kindError{ErrUnauthorized, err}
+	case http.StatusNotFound:
+		return &kindError{ErrNotFound, err}
+	case http.StatusConflict:
+		return &kindError{ErrConflict, err}
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return &kindError{ErrUnavailable, err}
+	}
+	return err
+}
+
+// fileError types a filesystem error by what it means for the note
+func fileError(err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return &kindError{ErrNotFound, err}
+	case errors.Is(err, fs.ErrExist):
+		return &kindError{ErrAlreadyExists, err}
+	}
+	return err
+}
+
+// requestError describes a failed HTTP request, reporting cancellation,
+// timeouts and rejected certificates as ErrCanceled, ErrTimeout and
+// ErrCertificate, and any other failure to reach Obsidian as ErrUnavailable
+func requestError(ctx context.Context, err error) error {
+	if ctxErr := contextError(ctx); ctxErr != nil {
+		return ctxErr
+	}
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return fmt.Errorf("%w: %v", ErrCertificate, certErr.Err)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	}
+	return fmt.Errorf("%w: %v", ErrUnavailable, err)
+}
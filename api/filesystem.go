@@ -0,0 +1,594 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"obsidian-mcp/security"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// FileSystemVault reads and writes a vault directory directly, without
+// requiring Obsidian or the Local REST API plugin to be running
+type FileSystemVault struct {
+	root string
+}
+
+// NewFileSystemVault creates a backend for the vault directory at root
+func NewFileSystemVault(root string) (*FileSystemVault, error) {
+	if root == "" {
+		return nil, fmt.Errorf("vault path is not configured")
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve vault path: %v", err)
+	}
+
+	info, err := os.Stat(absRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open vault: %v", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("vault path %s is not a directory", absRoot)
+	}
+	// Paths are checked against the real root once their symlinks are
+	// resolved
+	realRoot, err := filepath.EvalSymlinks(absRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve vault path: %v", err)
+	}
+
+	return &FileSystemVault{root: realRoot}, nil
+}
+
+// resolve maps a vault-relative path to a filesystem path inside the vault.
+// Symlinks are followed as far as the path exists, so a link can't lead out
+// of the vault.
+func (v *FileSystemVault) resolve(path string) (string, error) {
+	full := filepath.Join(v.root, filepath.FromSlash(path))
+	if !v.contains(full) {
+		return "", fmt.Errorf("%w: %q is outside the vault", security.ErrInvalidPath, path)
+	}
+
+	// Find the nearest part of the path that exists
+	for existing := full; ; existing = filepath.Dir(existing) {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			if !v.contains(resolved) {
+				return "", fmt.Errorf("%w: %q is outside the vault", security.ErrInvalidPath, path)
+			}
+			return full, nil
+		}
+		if _, lerr := os.Lstat(existing); lerr == nil || !errors.Is(err, fs.ErrNotExist) {
+			// A broken link, which writing would follow wherever it points
+			return "", fmt.Errorf("%w: %q can't be resolved: %v", security.ErrInvalidPath, path, err)
+		}
+		if existing == v.root {
+			return "", fmt.Errorf("failed to open vault: %w", fileError(err))
+		}
+	}
+}
+
+// resolveNote resolves the path of a note, which can't be the vault itself
+func (v *FileSystemVault) resolveNote(path string) (string, error) {
+	if strings.Trim(path, "/") == "" {
+		return "", fmt.Errorf("%w: note path is empty", security.ErrInvalidPath)
+	}
+	full, err := v.resolve(path)
+	if err != nil {
+		return "", err
+	}
+	if full == v.root {
+		return "", fmt.Errorf("%w: %q is the vault itself", security.ErrInvalidPath, path)
+	}
+	return full, nil
+}
+
+// contains reports whether a filesystem path lies in the vault
+func (v *FileSystemVault) contains(fullPath string) bool {
+	rel, err := filepath.Rel(v.root, fullPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// isHidden reports whether a file or folder is hidden from the vault,
+// like Obsidian's own .obsidian and .trash folders
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// walkNotes calls fn with the vault-relative path of every markdown note
+func (v *FileSystemVault) walkNotes(ctx context.Context, fn func(path, fullPath string) error) error {
+	return filepath.WalkDir(v.root, func(fullPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := contextError(ctx); err != nil {
+			return err
+		}
+		if fullPath != v.root && isHidden(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".md") {
+			return nil
+		}
+		rel, err := filepath.Rel(v.root, fullPath)
+		if err != nil {
+			return err
+		}
+		return fn(filepath.ToSlash(rel), fullPath)
+	})
+}
+
+// GetNote retrieves the content of a note by its path
+func (v *FileSystemVault) GetNote(ctx context.Context, path string) (string, error) {
+	path = NormalizeNotePath(path)
+	fullPath, err := v.resolveNote(path)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get note: %w", fileError(err))
+	}
+
+	return string(content), nil
+}
+
+// writeNote writes content to a note, creating parent folders as needed
+func (v *FileSystemVault) writeNote(path, content string) error {
+	fullPath, err := v.resolveNote(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(fullPath, []byte(content), 0o644)
+}
+
+// CreateNote creates a new note
+func (v *FileSystemVault) CreateNote(ctx context.Context, path, content string) (string, error) {
+	path = NormalizeNotePath(path)
+	if err := v.writeNote(path, content); err != nil {
+		return "", fmt.Errorf("failed to create note: %w", fileError(err))
+	}
+
+	return fmt.Sprintf("Successfully created note: %s", path), nil
+}
+
+// UpdateNote updates an existing note
+func (v *FileSystemVault) UpdateNote(ctx context.Context, path, content string) (string, error) {
+	path = NormalizeNotePath(path)
+	if err := v.writeNote(path, content); err != nil {
+		return "", fmt.Errorf("failed to update note: %w", fileError(err))
+	}
+
+	return fmt.Sprintf("Successfully updated note: %s", path), nil
+}
+
+// AppendNote appends content to the end of a note, creating it if needed
+func (v *FileSystemVault) AppendNote(ctx context.Context, path, content string) (string, error) {
+	path = NormalizeNotePath(path)
+	fullPath, err := v.resolveNote(path)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		return "", fmt.Errorf("failed to append to note: %w", fileError(err))
+	}
+
+	f, err := os.OpenFile(fullPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return "", fmt.Errorf("failed to append to note: %w", fileError(err))
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		return "", fmt.Errorf("failed to append to note: %w", fileError(err))
+	}
+
+	return fmt.Sprintf("Successfully appended to note: %s", path), nil
+}
+
+// PatchNote edits the section of a note below a heading, a block reference
+// or a frontmatter key
+func (v *FileSystemVault) PatchNote(ctx context.Context, path string, patch Patch) (string, error) {
+	path = NormalizeNotePath(path)
+	content, err := v.GetNote(ctx, path)
+	if err != nil {
+		return "", err
+	}
+
+	updated, err := ApplyPatch(content, patch)
+	if err != nil {
+		return "", fmt.Errorf("failed to patch note: %w", err)
+	}
+	if err := v.writeNote(path, updated); err != nil {
+		return "", fmt.Errorf("failed to patch note: %w", fileError(err))
+	}
+
+	return fmt.Sprintf("Successfully patched note: %s (%s %s %q)", path, patch.Operation, patch.TargetType, patch.Target), nil
+}
+
+// DeleteNote deletes a note
+func (v *FileSystemVault) DeleteNote(ctx context.Context, path string) (string, error) {
+	path = NormalizeNotePath(path)
+	fullPath, err := v.resolveNote(path)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.Remove(fullPath); err != nil {
+		return "", fmt.Errorf("failed to delete note: %w", fileError(err))
+	}
+
+	return fmt.Sprintf("Successfully deleted note: %s", path), nil
+}
+
+// MoveNote moves a note to a new path, creating parent folders as needed
+func (v *FileSystemVault) MoveNote(ctx context.Context, from, to string) (string, error) {
+	from = NormalizeNotePath(from)
+	to = NormalizeNotePath(to)
+
+	fromPath, err := v.resolveNote(from)
+	if err != nil {
+		return "", err
+	}
+	toPath, err := v.resolveNote(to)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(toPath); err == nil {
+		return "", fmt.Errorf("failed to move note: %s %w", to, ErrAlreadyExists)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(toPath), 0o755); err != nil {
+		return "", fmt.Errorf("failed to move note: %w", fileError(err))
+	}
+	if err := os.Rename(fromPath, toPath); err != nil {
+		return "", fmt.Errorf("failed to move note: %w", fileError(err))
+	}
+
+	return fmt.Sprintf("Successfully moved note: %s -> %s", from, to), nil
+}
+
+// ListNotes lists the notes directly inside the vault root or a folder
+func (v *FileSystemVault) ListNotes(ctx context.Context, folder string) ([]string, error) {
+	dir, err := v.resolve(folder)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes: %w", fileError(err))
+	}
+
+	notes := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() || isHidden(entry.Name()) || !strings.HasSuffix(entry.Name(), ".md") {
+			continue
+		}
+		notes = append(notes, entry.Name())
+	}
+
+	return notes, nil
+}
+
+// ListEntries lists the folders, notes and, if asked for, attachments in
+// the vault root or a folder. Sizes and modification times are always set.
+func (v *FileSystemVault) ListEntries(ctx context.Context, folder string, opts ListOptions) ([]Entry, error) {
+	dir, err := v.resolve(folder)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return []Entry{}, nil
+	}
+
+	entries := []Entry{}
+	err = filepath.WalkDir(dir, func(fullPath string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && fullPath != dir {
+			// Deleted while listing
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := contextError(ctx); err != nil {
+			return err
+		}
+		if fullPath == dir {
+			return nil
+		}
+		if isHidden(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, fullPath)
+		if err != nil {
+			return err
+		}
+		entry := Entry{Path: filepath.ToSlash(rel)}
+
+		switch {
+		case d.IsDir():
+			entry.Type = EntryFolder
+			entries = append(entries, entry)
+			if !opts.Recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		case strings.HasSuffix(d.Name(), ".md"):
+			entry.Type = EntryNote
+		case opts.Attachments:
+			entry.Type = EntryAttachment
+		default:
+			return nil
+		}
+
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			// Deleted while listing
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		entry.Size = info.Size()
+		entry.ModTime = info.ModTime().UnixMilli()
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes: %w", fileError(err))
+	}
+
+	return entries, nil
+}
+
+// ListAllNotes lists the paths of every note in the vault
+func (v *FileSystemVault) ListAllNotes(ctx context.Context) ([]string, error) {
+	notes := []string{}
+	err := v.walkNotes(ctx, func(path, fullPath string) error {
+		notes = append(notes, path)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes: %w", fileError(err))
+	}
+	return notes, nil
+}
+
+// NoteModTimes returns the modification time of every note in the vault
+// in milliseconds
+func (v *FileSystemVault) NoteModTimes(ctx context.Context) (map[string]int64, error) {
+	times := make(map[string]int64)
+	err := v.walkNotes(ctx, func(path, fullPath string) error {
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			return err
+		}
+		times[path] = info.ModTime().UnixMilli()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes: %w", fileError(err))
+	}
+	return times, nil
+}
+
+// GetVaultInfo gets information about the vault
+func (v *FileSystemVault) GetVaultInfo(ctx context.Context) (VaultInfo, error) {
+	notes, folders := 0, 0
+	err := filepath.WalkDir(v.root, func(fullPath string, d fs.DirEntry, err error) error {
+		if err != nil || fullPath == v.root {
+			return err
+		}
+		if err := contextError(ctx); err != nil {
+			return err
+		}
+		if isHidden(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			folders++
+		} else if strings.HasSuffix(d.Name(), ".md") {
+			notes++
+		}
+		return nil
+	})
+	if err != nil {
+		return VaultInfo{}, fmt.Errorf("failed to get vault info: %w", fileError(err))
+	}
+
+	return VaultInfo{
+		Path:          v.root,
+		Service:       "Filesystem vault",
+		Authenticated: true,
+		NotesCount:    notes,
+		FoldersCount:  folders,
+	}, nil
+}
+
+// Watch reports changes to notes from filesystem events. Notes moved or
+// deleted together with their folder are reported one by one.
+func (v *FileSystemVault) Watch(ctx context.Context, opts WatchOptions, fn func([]NoteChange)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	w := &fsWatch{
+		vault:   v,
+		watcher: watcher,
+		notes:   make(map[string]bool),
+		dirs:    make(map[string]bool),
+		changes: make(chan NoteChange),
+	}
+	if err := w.addTree(ctx, v.root, false); err != nil {
+		return fmt.Errorf("failed to watch vault: %v", err)
+	}
+
+	go debounceChanges(ctx, w.changes, opts, fn)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			w.handle(ctx, event)
+		case _, ok := <-watcher.Errors:
+			// Errors such as a queue overflow drop events but do not stop
+			// the watcher
+			if !ok {
+				return nil
+			}
+		}
+	}
+}
+
+// fsWatch tracks the notes and folders of a watched vault so that changes
+// to whole folders can be reported per note
+type fsWatch struct {
+	vault   *FileSystemVault
+	watcher *fsnotify.Watcher
+	// notes holds vault-relative note paths, dirs full folder paths
+	notes   map[string]bool
+	dirs    map[string]bool
+	changes chan NoteChange
+}
+
+// notePath returns the vault-relative path of a note, or false for files
+// that are not visible notes
+func (w *fsWatch) notePath(fullPath string) (string, bool) {
+	rel, err := filepath.Rel(w.vault.root, fullPath)
+	if err != nil || !strings.HasSuffix(rel, ".md") {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, part := range strings.Split(rel, "/") {
+		if isHidden(part) {
+			return "", false
+		}
+	}
+	return rel, true
+}
+
+// addTree watches dir and every visible folder below it. With report set,
+// the notes found are reported as created.
+func (w *fsWatch) addTree(ctx context.Context, dir string, report bool) error {
+	return filepath.WalkDir(dir, func(fullPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if fullPath != w.vault.root && isHidden(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			w.dirs[fullPath] = true
+			return w.watcher.Add(fullPath)
+		}
+		if report {
+			w.update(ctx, fullPath, true)
+		} else if path, ok := w.notePath(fullPath); ok {
+			w.notes[path] = true
+		}
+		return nil
+	})
+}
+
+// removeTree stops watching dir and reports the notes below it as deleted
+func (w *fsWatch) removeTree(ctx context.Context, dir string) {
+	prefix := dir + string(filepath.Separator)
+	for d := range w.dirs {
+		if d == dir || strings.HasPrefix(d, prefix) {
+			delete(w.dirs, d)
+			// The watch is usually gone with the folder already
+			_ = w.watcher.Remove(d)
+		}
+	}
+
+	rel, err := filepath.Rel(w.vault.root, dir)
+	if err != nil {
+		return
+	}
+	notePrefix := filepath.ToSlash(rel) + "/"
+	for path := range w.notes {
+		if strings.HasPrefix(path, notePrefix) {
+			delete(w.notes, path)
+			sendChange(ctx, w.changes, path, NoteDeleted)
+		}
+	}
+}
+
+// update reports a note as created, modified or deleted depending on
+// whether it exists now and whether it was known before
+func (w *fsWatch) update(ctx context.Context, fullPath string, exists bool) {
+	path, ok := w.notePath(fullPath)
+	if !ok {
+		return
+	}
+
+	known := w.notes[path]
+	switch {
+	case exists && known:
+		sendChange(ctx, w.changes, path, NoteModified)
+	case exists:
+		w.notes[path] = true
+		sendChange(ctx, w.changes, path, NoteCreated)
+	case known:
+		delete(w.notes, path)
+		sendChange(ctx, w.changes, path, NoteDeleted)
+	}
+}
+
+// handle translates a filesystem event into note changes
+func (w *fsWatch) handle(ctx context.Context, event fsnotify.Event) {
+	switch {
+	case event.Has(fsnotify.Create):
+		info, err := os.Stat(event.Name)
+		if err != nil {
+			return
+		}
+		if info.IsDir() {
+			// Folders moved into the vault may already contain notes
+			_ = w.addTree(ctx, event.Name, true)
+			return
+		}
+		w.update(ctx, event.Name, true)
+	case event.Has(fsnotify.Write):
+		w.update(ctx, event.Name, true)
+	case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+		if w.dirs[event.Name] {
+			w.removeTree(ctx, event.Name)
+			return
+		}
+		w.update(ctx, event.Name, false)
+	}
+}
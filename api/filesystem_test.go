@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"obsidian-mcp/security"
+)
+
+func TestFileSystemListEntries(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.md", "pic.png", "Projects/b.md", "Projects/Old/c.md", "Projects/doc.pdf", ".obsidian/app.json", "Projects/.hidden.md"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, name), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vault, err := NewFileSystemVault(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		folder string
+		opts   ListOptions
+		want   []string
+	}{
+		{"", ListOptions{}, []string{"Projects/ folder", "a.md note"}},
+		{"", ListOptions{Attachments: true}, []string{"Projects/ folder", "a.md note", "pic.png attachment"}},
+		{"", ListOptions{Recursive: true}, []string{"Projects/ folder", "Projects/Old/ folder", "Projects/Old/c.md note", "Projects/b.md note", "a.md note"}},
+		{"Projects", ListOptions{Recursive: true, Attachments: true}, []string{"Old/ folder", "Old/c.md note", "b.md note", "doc.pdf attachment"}},
+		{"Missing", ListOptions{Recursive: true}, nil},
+	}
+
+	for _, tt := range tests {
+		entries, err := vault.ListEntries(context.Background(), tt.folder, tt.opts)
+		if err != nil {
+			t.Errorf("ListEntries(%q, %+v): %v", tt.folder, tt.opts, err)
+			continue
+		}
+		var got []string
+		for _, entry := range entries {
+			name := entry.Path
+			if entry.Type == EntryFolder {
+				name += "/"
+			}
+			got = append(got, name+" "+entry.Type)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ListEntries(%q, %+v) = %v, want %v", tt.folder, tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestFileSystemResolveSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	root, outside := filepath.Join(dir, "vault"), filepath.Join(dir, "outside")
+	for _, name := range []string{filepath.Join(root, "Folder", "a.md"), filepath.Join(outside, "secret.md")} {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"out":         outside,
+		"note.md":     filepath.Join(outside, "secret.md"),
+		"dangling.md": filepath.Join(outside, "new.md"),
+		"inner":       filepath.Join(root, "Folder"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+	// The vault itself may be reached through a link
+	if err := os.Symlink(root, filepath.Join(dir, "vault-link")); err != nil {
+		t.Fatal(err)
+	}
+	vault, err := NewFileSystemVault(filepath.Join(dir, "vault-link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		call    func() error
+		wantErr bool
+	}{
+		{"read through a folder link", func() error { _, err := vault.GetNote(ctx, "out/secret.md"); return err }, true},
+		{"read a file link", func() error { _, err := vault.GetNote(ctx, "note.md"); return err }, true},
+		{"create through a folder link", func() error { _, err := vault.CreateNote(ctx, "out/new.md", "x"); return err }, true},
+		{"create below a folder link", func() error { _, err := vault.CreateNote(ctx, "out/sub/new.md", "x"); return err }, true},
+		{"write a broken link", func() error { _, err := vault.UpdateNote(ctx, "dangling.md", "x"); return err }, true},
+		{"move out", func() error { _, err := vault.MoveNote(ctx, "Folder/a.md", "out/a.md"); return err }, true},
+		{"list a folder link", func() error { _, err := vault.ListEntries(ctx, "out", ListOptions{}); return err }, true},
+		{"empty path", func() error { _, err := vault.GetNote(ctx, ""); return err }, true},
+		{"vault root", func() error { _, err := vault.GetNote(ctx, "."); return err }, true},
+		{"link inside the vault", func() error { _, err := vault.GetNote(ctx, "inner/a.md"); return err }, false},
+		{"new folders", func() error { _, err := vault.CreateNote(ctx, "New/Deeper/b.md", "x"); return err }, false},
+	}
+	for _, tt := range tests {
+		err := tt.call()
+		if tt.wantErr && !errors.Is(err, security.ErrInvalidPath) {
+			t.Errorf("%s: error = %v, want ErrInvalidPath", tt.name, err)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+
+	for _, name := range []string{"new.md", "sub", "a.md"} {
+		if _, err := os.Lstat(filepath.Join(outside, name)); err == nil {
+			t.Errorf("%s was written outside the vault", name)
+		}
+	}
+}
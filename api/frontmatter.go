@@ -0,0 +1,294 @@
+package api
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// frontmatterDelimiter opens and closes a YAML frontmatter block
+const frontmatterDelimiter = "---"
+
+// splitFrontmatter splits note content into the raw YAML of its leading
+// frontmatter block and the body that follows it. ok is false when the
+// note has no frontmatter, in which case body is the whole content.
+func splitFrontmatter(content string) (frontmatter, body string, ok bool) {
+	first, rest, found := strings.Cut(content, "\n")
+	if !found || strings.TrimRight(first, "\r") != frontmatterDelimiter {
+		return "", content, false
+	}
+
+	offset := 0
+	for offset <= len(rest) {
+		line, _, more := strings.Cut(rest[offset:], "\n")
+		trimmed := strings.TrimRight(line, "\r")
+		if trimmed == frontmatterDelimiter || trimmed == "..." {
+			end := offset + len(line)
+			if more {
+				end++
+			}
+			return rest[:offset], rest[end:], true
+		}
+		if !more {
+			break
+		}
+		offset += len(line) + 1
+	}
+
+	return "", content, false
+}
+
+// parseFrontmatter parses the leading YAML frontmatter of a note. Key order
+// is preserved. Notes without frontmatter yield an empty MapSlice.
+func parseFrontmatter(content string) (yaml.MapSlice, string, error) {
+	raw, body, ok := splitFrontmatter(content)
+	if !ok {
+		return yaml.MapSlice{}, body, nil
+	}
+
+	var fm yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(raw), &fm); err != nil {
+		return nil, body, fmt.Errorf("invalid frontmatter: %v", err)
+	}
+	if fm == nil {
+		fm = yaml.MapSlice{}
+	}
+	return fm, body, nil
+}
+
+// renderFrontmatter joins frontmatter and body back into note content. An
+// empty frontmatter is omitted entirely.
+func renderFrontmatter(fm yaml.MapSlice, body string) (string, error) {
+	if len(fm) == 0 {
+		return body, nil
+	}
+
+	data, err := yaml.Marshal(fm)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode frontmatter: %v", err)
+	}
+	return frontmatterDelimiter + "\n" + string(data) + frontmatterDelimiter + "\n" + body, nil
+}
+
+// frontmatterBlock is the text of one top-level key of a frontmatter block
+// with the lines of its value, and the comment and blank lines above it
+type frontmatterBlock struct {
+	// key is empty for lines before the first key
+	key     string
+	leading string
+	text    string
+}
+
+// splitFrontmatterBlocks splits the raw YAML of a frontmatter block into
+// its top-level keys. ok is false if a key can't be parsed on its own, for
+// example because it refers to an anchor of another key.
+func splitFrontmatterBlocks(raw string) (blocks []frontmatterBlock, ok bool) {
+	blocks = []frontmatterBlock{{}}
+	trailing := ""
+	for _, line := range splitLines(raw) {
+		trimmed := strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.TrimSpace(trimmed) == "" || strings.HasPrefix(trimmed, "#"):
+			// Belongs to the next key if one follows, else to this value
+			trailing += line
+		case trimmed[0] != ' ' && trimmed[0] != '\t' && trimmed[0] != '-':
+			blocks = append(blocks, frontmatterBlock{leading: trailing, text: line})
+			trailing = ""
+		default:
+			blocks[len(blocks)-1].text += trailing + line
+			trailing = ""
+		}
+	}
+	blocks[len(blocks)-1].text += trailing
+
+	for i := 1; i < len(blocks); i++ {
+		var item yaml.MapSlice
+		if err := yaml.Unmarshal([]byte(blocks[i].text), &item); err != nil || len(item) != 1 {
+			return nil, false
+		}
+		blocks[i].key = fmt.Sprint(item[0].Key)
+	}
+	return blocks, true
+}
+
+// editFrontmatter sets and removes top-level frontmatter keys. Only the
+// lines of the keys that change are rewritten, so other keys keep their
+// formatting and comments. Keys in set that don't exist yet are added at
+// the end in the order given, and a frontmatter left without keys is
+// removed.
+func editFrontmatter(content string, set yaml.MapSlice, remove func(key string) bool) (string, error) {
+	fm, body, err := parseFrontmatter(content)
+	if err != nil {
+		return "", err
+	}
+	raw, _, _ := splitFrontmatter(content)
+	blocks, ok := splitFrontmatterBlocks(raw)
+	if !ok {
+		// Fall back to encoding the whole frontmatter again
+		edited := yaml.MapSlice{}
+		for _, item := range fm {
+			key := fmt.Sprint(item.Key)
+			if i := frontmatterIndex(set, key); i >= 0 {
+				item.Value = set[i].Value
+			} else if remove != nil && remove(key) {
+				continue
+			}
+			edited = append(edited, item)
+		}
+		for _, item := range set {
+			if frontmatterIndex(fm, fmt.Sprint(item.Key)) < 0 {
+				edited = append(edited, item)
+			}
+		}
+		return renderFrontmatter(edited, body)
+	}
+
+	var b strings.Builder
+	keys := 0
+	write := func(leading string, item yaml.MapItem) error {
+		data, err := yaml.Marshal(yaml.MapSlice{item})
+		if err != nil {
+			return fmt.Errorf("failed to encode frontmatter: %v", err)
+		}
+		b.WriteString(leading)
+		b.Write(data)
+		keys++
+		return nil
+	}
+
+	b.WriteString(blocks[0].text)
+	for _, block := range blocks[1:] {
+		if i := frontmatterIndex(set, block.key); i >= 0 {
+			if err := write(block.leading, set[i]); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if remove != nil && remove(block.key) {
+			continue
+		}
+		b.WriteString(block.leading)
+		b.WriteString(ensureNewline(block.text))
+		keys++
+	}
+	for _, item := range set {
+		if frontmatterIndex(fm, fmt.Sprint(item.Key)) < 0 {
+			if err := write("", item); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if keys == 0 {
+		return body, nil
+	}
+	return frontmatterDelimiter + "\n" + b.String() + frontmatterDelimiter + "\n" + body, nil
+}
+
+// frontmatterIndex returns the position of key in fm, or -1
+func frontmatterIndex(fm yaml.MapSlice, key string) int {
+	for i, item := range fm {
+		if fmt.Sprint(item.Key) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// Frontmatter update modes
+const (
+	// FrontmatterMerge sets the given keys and keeps all others
+	FrontmatterMerge = "merge"
+	// FrontmatterReplace drops keys that are not given
+	FrontmatterReplace = "replace"
+)
+
+// FrontmatterUpdate describes changes to the frontmatter of a note
+type FrontmatterUpdate struct {
+	// Properties are the keys to set, with JSON-compatible values
+	Properties map[string]interface{}
+	// Mode is merge (default) or replace
+	Mode string
+	// Delete lists keys to remove
+	Delete []string
+}
+
+// ReadFrontmatter returns the frontmatter of a note as JSON-compatible
+// values, together with its keys in document order
+func ReadFrontmatter(content string) (map[string]interface{}, []string, error) {
+	fm, _, err := parseFrontmatter(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := make(map[string]interface{}, len(fm))
+	keys := make([]string, 0, len(fm))
+	for _, item := range fm {
+		key := fmt.Sprint(item.Key)
+		values[key] = jsonValue(item.Value)
+		keys = append(keys, key)
+	}
+	return values, keys, nil
+}
+
+// UpdateFrontmatter applies an update to the frontmatter of a note. The body
+// and the keys the update doesn't touch are kept byte for byte, and existing
+// keys keep their order; new keys are added at the end in alphabetical
+// order.
+func UpdateFrontmatter(content string, update FrontmatterUpdate) (string, error) {
+	switch update.Mode {
+	case "", FrontmatterMerge, FrontmatterReplace:
+	default:
+		return "", fmt.Errorf("invalid mode %q (expected %s or %s)", update.Mode, FrontmatterMerge, FrontmatterReplace)
+	}
+
+	keys := make([]string, 0, len(update.Properties))
+	for key := range update.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	set := make(yaml.MapSlice, 0, len(keys))
+	for _, key := range keys {
+		if !slices.Contains(update.Delete, key) {
+			set = append(set, yaml.MapItem{Key: key, Value: update.Properties[key]})
+		}
+	}
+
+	return editFrontmatter(content, set, func(key string) bool {
+		if slices.Contains(update.Delete, key) {
+			return true
+		}
+		_, ok := update.Properties[key]
+		return update.Mode == FrontmatterReplace && !ok
+	})
+}
+
+// jsonValue converts values decoded by yaml.v2 into types that encode as
+// JSON, turning nested maps into map[string]interface{}
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		m := make(map[string]interface{}, len(v))
+		for _, item := range v {
+			m[fmt.Sprint(item.Key)] = jsonValue(item.Value)
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = jsonValue(item)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = jsonValue(item)
+		}
+		return list
+	default:
+		return v
+	}
+}
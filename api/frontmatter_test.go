@@ -0,0 +1,138 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUpdateFrontmatter(t *testing.T) {
+	const note = "---\n" +
+		"# planning note\n" +
+		"title: \"Plan\"\n" +
+		"due: 2025-01-01\n" +
+		"count: 007\n" +
+		"tags: [a, b]\n" +
+		"\n" +
+		"# where it stands\n" +
+		"status: draft\n" +
+		"summary: |\n" +
+		"  first line\n" +
+		"\n" +
+		"  second paragraph\n" +
+		"---\n" +
+		"body\n"
+
+	tests := []struct {
+		name    string
+		content string
+		update  FrontmatterUpdate
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "set one key keeps the others",
+			content: note,
+			update:  FrontmatterUpdate{Properties: map[string]interface{}{"status": "done"}},
+			want: "---\n# planning note\ntitle: \"Plan\"\ndue: 2025-01-01\ncount: 007\ntags: [a, b]\n" +
+				"\n# where it stands\nstatus: done\nsummary: |\n  first line\n\n  second paragraph\n---\nbody\n",
+		},
+		{
+			name:    "add key",
+			content: note,
+			update:  FrontmatterUpdate{Properties: map[string]interface{}{"priority": 2, "area": "work"}},
+			want:    note[:len(note)-len("---\nbody\n")] + "area: work\npriority: 2\n---\nbody\n",
+		},
+		{
+			name:    "delete key with its comment",
+			content: note,
+			update:  FrontmatterUpdate{Delete: []string{"status"}},
+			want: "---\n# planning note\ntitle: \"Plan\"\ndue: 2025-01-01\ncount: 007\ntags: [a, b]\n" +
+				"summary: |\n  first line\n\n  second paragraph\n---\nbody\n",
+		},
+		{
+			name:    "delete key with a multi-line value",
+			content: note,
+			update:  FrontmatterUpdate{Delete: []string{"summary"}},
+			want: "---\n# planning note\ntitle: \"Plan\"\ndue: 2025-01-01\ncount: 007\ntags: [a, b]\n" +
+				"\n# where it stands\nstatus: draft\n---\nbody\n",
+		},
+		{
+			name:    "replace mode",
+			content: "---\na: 1\nb: 2 # two\nc: 3\n---\nbody\n",
+			update:  FrontmatterUpdate{Properties: map[string]interface{}{"c": 4, "b": 2}, Mode: FrontmatterReplace},
+			want:    "---\nb: 2\nc: 4\n---\nbody\n",
+		},
+		{
+			name:    "nested values",
+			content: "---\nmeta:\n  owner: ann\n  team: x\nother: 1\n---\nbody\n",
+			update:  FrontmatterUpdate{Properties: map[string]interface{}{"meta": map[string]interface{}{"owner": "bob"}}},
+			want:    "---\nmeta:\n  owner: bob\nother: 1\n---\nbody\n",
+		},
+		{
+			name:    "block list kept",
+			content: "---\ntags:\n  - a\n  - b\nstatus: draft\n---\n",
+			update:  FrontmatterUpdate{Properties: map[string]interface{}{"status": "done"}},
+			want:    "---\ntags:\n  - a\n  - b\nstatus: done\n---\n",
+		},
+		{
+			name:    "no frontmatter",
+			content: "body\n",
+			update:  FrontmatterUpdate{Properties: map[string]interface{}{"status": "done"}},
+			want:    "---\nstatus: done\n---\nbody\n",
+		},
+		{
+			name:    "removing every key drops the frontmatter",
+			content: "---\n# note\na: 1\n---\nbody\n",
+			update:  FrontmatterUpdate{Delete: []string{"a"}},
+			want:    "body\n",
+		},
+		{
+			name:    "anchors fall back to encoding everything",
+			content: "---\nbase: &b x\ncopy: *b\nstatus: draft\n---\nbody\n",
+			update:  FrontmatterUpdate{Properties: map[string]interface{}{"status": "done"}},
+			want:    "---\nbase: x\ncopy: x\nstatus: done\n---\nbody\n",
+		},
+		{
+			name:    "invalid mode",
+			content: note,
+			update:  FrontmatterUpdate{Mode: "upsert"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid frontmatter",
+			content: "---\na: [\n---\nbody\n",
+			update:  FrontmatterUpdate{Properties: map[string]interface{}{"a": 1}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UpdateFrontmatter(tt.content, tt.update)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UpdateFrontmatter() error = %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("UpdateFrontmatter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadFrontmatter(t *testing.T) {
+	values, keys, err := ReadFrontmatter("---\nb: 1\na: [x, z]\nc:\n  d: true\n---\nbody\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"b", "a", "c"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+	want := map[string]interface{}{
+		"b": 1,
+		"a": []interface{}{"x", "z"},
+		"c": map[string]interface{}{"d": true},
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("values = %#v, want %#v", values, want)
+	}
+}
@@ -0,0 +1,343 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"obsidian-mcp/search"
+)
+
+// indexSaveInterval is how often a changed index is saved, and how long
+// Build waits before trying again when the vault can't be read
+const indexSaveInterval = time.Minute
+
+// IndexedVault answers search queries from a local full-text index over
+// the notes of another backend, ranking results with BM25. Notes written
+// through it and changes reported by its watcher update the index as they
+// happen. While nothing watches the backend, each search first picks up
+// the notes changed behind it. Until the index has been built, searches go
+// to the wrapped backend.
+type IndexedVault struct {
+	VaultBackend
+	// file is where the index is saved, empty to keep it in memory only
+	file     string
+	name     string
+	ready    atomic.Bool
+	watching atomic.Bool
+
+	mu    sync.RWMutex
+	index *search.Index
+	// refreshing serializes refresh
+	refreshing sync.Mutex
+}
+
+// NewIndexedVault wraps a backend with a full-text index saved to file.
+// The index is loaded and brought up to date by Build.
+func NewIndexedVault(backend VaultBackend, name, file string) *IndexedVault {
+	return &IndexedVault{VaultBackend: backend, name: name, file: file, index: search.NewIndex()}
+}
+
+// Unwrap returns the wrapped backend
+func (v *IndexedVault) Unwrap() VaultBackend {
+	return v.VaultBackend
+}
+
+// Build loads the saved index, indexes the notes that changed since it was
+// saved and saves it, then saves it periodically until ctx is done. If the
+// vault can't be read, Build tries again after a while.
+func (v *IndexedVault) Build(ctx context.Context) {
+	start := time.Now()
+	if v.file != "" {
+		index, err := search.LoadIndex(v.file)
+		switch {
+		case err == nil:
+			v.mu.Lock()
+			v.index = index
+			v.mu.Unlock()
+		case !errors.Is(err, fs.ErrNotExist):
+			log.Printf("Warning: rebuilding search index of vault %q: %v", v.name, err)
+		}
+	}
+
+	indexed, err := v.refresh(ctx)
+	for err != nil {
+		log.Printf("Warning: search index of vault %q not built, searching through the backend: %v", v.name, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(indexSaveInterval):
+		}
+		indexed, err = v.refresh(ctx)
+	}
+	v.ready.Store(true)
+	log.Printf("Search index of vault %q ready: %d notes, %d reindexed in %s", v.name, v.currentIndex().Len(), indexed, time.Since(start).Round(time.Millisecond))
+	v.save()
+
+	ticker := time.NewTicker(indexSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			v.save()
+		}
+	}
+}
+
+// Save writes the index to its file if it changed
+func (v *IndexedVault) Save() error {
+	if v.file == "" || !v.ready.Load() {
+		return nil
+	}
+	return v.currentIndex().Save(v.file)
+}
+
+func (v *IndexedVault) save() {
+	if err := v.Save(); err != nil {
+		log.Printf("Warning: failed to save search index of vault %q: %v", v.name, err)
+	}
+}
+
+func (v *IndexedVault) currentIndex() *search.Index {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.index
+}
+
+// refresh indexes the notes whose modification time differs from the one
+// they were indexed at and drops deleted notes, returning how many notes
+// were read
+func (v *IndexedVault) refresh(ctx context.Context) (int, error) {
+	v.refreshing.Lock()
+	defer v.refreshing.Unlock()
+
+	var times map[string]int64
+	if lister, ok := v.VaultBackend.(ModTimeLister); ok {
+		var err error
+		if times, err = lister.NoteModTimes(ctx); err != nil {
+			return 0, err
+		}
+	} else {
+		notes, err := v.ListAllNotes(ctx)
+		if err != nil {
+			return 0, err
+		}
+		times = make(map[string]int64, len(notes))
+		for _, note := range notes {
+			times[note] = 0
+		}
+	}
+
+	index := v.currentIndex()
+	stamps := index.Stamps()
+	for note := range stamps {
+		if _, ok := times[note]; !ok {
+			index.Remove(note)
+		}
+	}
+
+	indexed := 0
+	for note, mtime := range times {
+		if !indexable(note) {
+			continue
+		}
+		if stamp, ok := stamps[note]; ok && stamp == mtime && mtime != 0 {
+			continue
+		}
+		content, err := v.VaultBackend.GetNote(ctx, note)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return indexed, fmt.Errorf("failed to index %s: %w", note, err)
+		}
+		index.Add(note, content, mtime)
+		indexed++
+	}
+	return indexed, nil
+}
+
+// reindex updates the index entry of a note from its current content. The
+// note is indexed without a modification time, so the next Build reads it
+// again.
+func (v *IndexedVault) reindex(ctx context.Context, notePath string) {
+	notePath = NormalizeNotePath(notePath)
+	if !indexable(notePath) {
+		return
+	}
+	content, err := v.VaultBackend.GetNote(context.WithoutCancel(ctx), notePath)
+	if errors.Is(err, ErrNotFound) {
+		v.currentIndex().Remove(notePath)
+		return
+	}
+	if err != nil {
+		log.Printf("Warning: failed to index %s in vault %q: %v", notePath, v.name, err)
+		return
+	}
+	v.currentIndex().Add(notePath, content, 0)
+}
+
+// indexable reports whether a path is a visible note
+func indexable(notePath string) bool {
+	if !strings.HasSuffix(notePath, ".md") {
+		return false
+	}
+	for _, part := range strings.Split(notePath, "/") {
+		if strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+	return true
+}
+
+// CreateNote creates a note and indexes it
+func (v *IndexedVault) CreateNote(ctx context.Context, path, content string) (string, error) {
+	msg, err := v.VaultBackend.CreateNote(ctx, path, content)
+	if err == nil {
+		v.reindex(ctx, path)
+	}
+	return msg, err
+}
+
+// UpdateNote updates a note and reindexes it
+func (v *IndexedVault) UpdateNote(ctx context.Context, path, content string) (string, error) {
+	msg, err := v.VaultBackend.UpdateNote(ctx, path, content)
+	if err == nil {
+		v.reindex(ctx, path)
+	}
+	return msg, err
+}
+
+// AppendNote appends to a note and reindexes it
+func (v *IndexedVault) AppendNote(ctx context.Context, path, content string) (string, error) {
+	msg, err := v.VaultBackend.AppendNote(ctx, path, content)
+	if err == nil {
+		v.reindex(ctx, path)
+	}
+	return msg, err
+}
+
+// PatchNote patches a note and reindexes it
+func (v *IndexedVault) PatchNote(ctx context.Context, path string, patch Patch) (string, error) {
+	msg, err := v.VaultBackend.PatchNote(ctx, path, patch)
+	if err == nil {
+		v.reindex(ctx, path)
+	}
+	return msg, err
+}
+
+// DeleteNote deletes a note and drops it from the index
+func (v *IndexedVault) DeleteNote(ctx context.Context, path string) (string, error) {
+	msg, err := v.VaultBackend.DeleteNote(ctx, path)
+	if err == nil {
+		v.currentIndex().Remove(NormalizeNotePath(path))
+	}
+	return msg, err
+}
+
+// MoveNote moves a note and moves its index entry along
+func (v *IndexedVault) MoveNote(ctx context.Context, from, to string) (string, error) {
+	msg, err := v.VaultBackend.MoveNote(ctx, from, to)
+	if err == nil {
+		v.currentIndex().Remove(NormalizeNotePath(from))
+		v.reindex(ctx, to)
+	}
+	return msg, err
+}
+
+// Watch reports changes to notes from the wrapped backend's watcher,
+// updating the index before passing them on. Searches rely on the watcher
+// to keep the index current for as long as it runs.
+func (v *IndexedVault) Watch(ctx context.Context, opts WatchOptions, fn func([]NoteChange)) error {
+	watcher, ok := v.VaultBackend.(Watcher)
+	if !ok {
+		return fmt.Errorf("backend cannot report changes")
+	}
+	v.watching.Store(true)
+	defer v.watching.Store(false)
+	return watcher.Watch(ctx, opts, func(changes []NoteChange) {
+		for _, change := range changes {
+			if change.Kind == NoteDeleted {
+				v.currentIndex().Remove(change.Path)
+			} else {
+				v.reindex(ctx, change.Path)
+			}
+		}
+		fn(changes)
+	})
+}
+
+// QueryNotes evaluates a search query on the notes the index finds for its
+// words and phrases, or on every note if it has none, and ranks the
+// results with BM25. Queries of plain words are answered by the index
+// alone. Without a watcher, the index is refreshed first.
+func (v *IndexedVault) QueryNotes(ctx context.Context, query *search.Query, opts SearchOptions) ([]SearchResult, error) {
+	if !v.ready.Load() {
+		return scanNotes(ctx, v.VaultBackend, query, nil, opts)
+	}
+	if !v.watching.Load() {
+		if _, err := v.refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	index := v.currentIndex()
+	if query.Plain() {
+		return v.searchIndex(ctx, index, query, opts)
+	}
+	candidates, _ := index.Candidates(query)
+	results, err := scanNotes(ctx, v.VaultBackend, query, candidates, opts)
+	terms := query.Terms()
+	if err != nil || len(terms) == 0 {
+		return results, err
+	}
+
+	scores := make(map[string]float64)
+	for _, hit := range index.Search(terms) {
+		scores[hit.Path] = hit.Score
+	}
+	for i := range results {
+		results[i].Score = scores[results[i].Path]
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	return results, nil
+}
+
+// searchIndex returns the notes containing every word of a plain query,
+// ranked with BM25. Only the results in the range of opts have matches,
+// since finding them needs the content of each note.
+func (v *IndexedVault) searchIndex(ctx context.Context, index *search.Index, query *search.Query, opts SearchOptions) ([]SearchResult, error) {
+	candidates, _ := index.Candidates(query)
+	matching := make(map[string]bool, len(candidates))
+	for _, note := range candidates {
+		matching[note] = true
+	}
+
+	results := []SearchResult{}
+	for _, hit := range index.Search(query.Terms()) {
+		if !matching[hit.Path] || !opts.included(hit.Path) {
+			continue
+		}
+		result := SearchResult{Path: hit.Path, Score: hit.Score, Matches: []SearchMatch{}}
+		if opts.inPage(len(results)) && opts.MaxMatches > 0 {
+			content, err := v.VaultBackend.GetNote(ctx, hit.Path)
+			if err := contextError(ctx); err != nil {
+				return nil, err
+			}
+			if err == nil {
+				result.Matches = spanMatches(content, query.Highlights(content), opts)
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,431 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// wikilinkPattern matches [[target#anchor|alias]] and ![[embeds]]
+	wikilinkPattern = regexp.MustCompile(`(!?\[\[)([^\[\]|#\n]*)(#[^\[\]|\n]*)?(\|[^\[\]\n]*)?(\]\])`)
+	// markdownLinkPattern matches [text](target "title") and ![images](target)
+	markdownLinkPattern = regexp.MustCompile(`(!?\[[^\]\n]*\]\()(<[^>\n]+>|[^)\s]+)((?:\s+"[^"\n]*")?\))`)
+)
+
+// LinkUpdate describes the links rewritten in one note. Pinned counts the
+// links that would have resolved to the moved note after the move and were
+// qualified with the path of the note they pointed at before.
+type LinkUpdate struct {
+	Path   string `json:"path"`
+	Links  int    `json:"links"`
+	Pinned int    `json:"pinned,omitempty"`
+}
+
+// MoveResult describes the outcome of moving a note. NotUpdated lists the
+// notes whose links could not be rewritten after the note was moved, and
+// Unreadable counts the notes left alone because the caller can't read them.
+type MoveResult struct {
+	From         string       `json:"from"`
+	To           string       `json:"to"`
+	DryRun       bool         `json:"dry_run"`
+	UpdatedNotes []LinkUpdate `json:"updated_notes"`
+	LinksUpdated int          `json:"links_updated"`
+	LinksPinned  int          `json:"links_pinned"`
+	NotUpdated   []string     `json:"not_updated,omitempty"`
+	Unreadable   int          `json:"unreadable,omitempty"`
+}
+
+// RelocateOptions controls how RelocateNote moves a note
+type RelocateOptions struct {
+	// DryRun lists the notes that would change without writing anything
+	DryRun bool
+	// CanRead, if set, reports whether the caller may read a note. Notes it
+	// may not are neither read nor named, only counted.
+	CanRead func(notePath string) bool
+	// CanUpdate, if set, is asked before anything is written whether each
+	// note with links to rewrite may be changed; the move fails if one may
+	// not
+	CanUpdate func(notePath string) error
+	// Lock, if set, locks a note against other writes while its links are
+	// rewritten and returns the function that unlocks it. The moved note is
+	// not passed; the caller holds it for the whole move.
+	Lock func(notePath string) func()
+}
+
+// RelocateNote moves a note and rewrites the wikilinks and markdown links
+// that point at it in every other note, keeping aliases and heading/block
+// anchors intact. Relative markdown links inside the moved note, including
+// those to images and other attachments, are adjusted to its new folder.
+// Wikilinks by name that would resolve to the moved note after the move
+// instead of the note they point at now are pinned to that note's path.
+// Each note is read again under its lock before its links are rewritten,
+// so edits made to it during the move are kept. If rewriting links fails
+// after the move, the remaining notes are still updated and the error
+// names those that weren't.
+func RelocateNote(ctx context.Context, vault VaultBackend, from, to string, opts RelocateOptions) (MoveResult, error) {
+	from = NormalizeNotePath(from)
+	to = NormalizeNotePath(to)
+	result := MoveResult{From: from, To: to, DryRun: opts.DryRun, UpdatedNotes: []LinkUpdate{}}
+
+	if from == to {
+		return result, fmt.Errorf("source and destination are the same: %s", from)
+	}
+	if _, err := vault.GetNote(ctx, from); err != nil {
+		return result, fmt.Errorf("failed to read source note: %w", err)
+	}
+	exists, err := NoteExists(ctx, vault, to)
+	if err != nil {
+		return result, fmt.Errorf("failed to check destination note: %w", err)
+	}
+	if exists {
+		return result, fmt.Errorf("destination note %w: %s", ErrAlreadyExists, to)
+	}
+
+	entries, err := vault.ListEntries(ctx, "", ListOptions{Recursive: true, Attachments: true})
+	if err != nil {
+		return result, err
+	}
+	var notes, files []string
+	for _, entry := range entries {
+		switch entry.Type {
+		case EntryNote:
+			notes = append(notes, entry.Path)
+			files = append(files, entry.Path)
+		case EntryAttachment:
+			files = append(files, entry.Path)
+		}
+	}
+	rw := newLinkRewriter(files, from, to)
+
+	// Compute all rewrites before touching the vault
+	var movedContent string
+	for _, note := range notes {
+		if note != from && opts.CanRead != nil && !opts.CanRead(note) {
+			result.Unreadable++
+			continue
+		}
+		content, err := vault.GetNote(ctx, note)
+		if err != nil {
+			return result, fmt.Errorf("failed to read %s: %w", note, err)
+		}
+		updated, count, pinned := rw.rewrite(note, content)
+		if count == 0 {
+			continue
+		}
+		target := note
+		if note == from {
+			target = to
+		} else if opts.CanUpdate != nil {
+			if err := opts.CanUpdate(note); err != nil {
+				return result, fmt.Errorf("cannot update links in %s: %w", note, err)
+			}
+		}
+		if target == to {
+			movedContent = updated
+		}
+		result.UpdatedNotes = append(result.UpdatedNotes, LinkUpdate{Path: target, Links: count, Pinned: pinned})
+		result.LinksUpdated += count
+		result.LinksPinned += pinned
+	}
+	sort.Slice(result.UpdatedNotes, func(i, j int) bool { return result.UpdatedNotes[i].Path < result.UpdatedNotes[j].Path })
+
+	if opts.DryRun {
+		return result, nil
+	}
+
+	if _, err := vault.MoveNote(ctx, from, to); err != nil {
+		return result, err
+	}
+	var firstErr error
+	for _, update := range result.UpdatedNotes {
+		var err error
+		if update.Path == to {
+			_, err = vault.UpdateNote(ctx, to, movedContent)
+		} else {
+			err = rewriteLinks(ctx, vault, rw, update.Path, opts.Lock)
+		}
+		if err != nil {
+			result.NotUpdated = append(result.NotUpdated, update.Path)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if firstErr != nil {
+		return result, fmt.Errorf("moved note but failed to update links in %s: %w", strings.Join(result.NotUpdated, ", "), firstErr)
+	}
+
+	return result, nil
+}
+
+// rewriteLinks reads a note under its lock and writes it back with its
+// links rewritten
+func rewriteLinks(ctx context.Context, vault VaultBackend, rw *linkRewriter, notePath string, lock func(string) func()) error {
+	if lock != nil {
+		defer lock(notePath)()
+	}
+	content, err := vault.GetNote(ctx, notePath)
+	if err != nil {
+		return err
+	}
+	updated, count, _ := rw.rewrite(notePath, content)
+	if count == 0 {
+		return nil
+	}
+	_, err = vault.UpdateNote(ctx, notePath, updated)
+	return err
+}
+
+// linkIndex resolves link targets to vault files, ignoring case like
+// Obsidian's link resolution
+type linkIndex struct {
+	files  map[string]string
+	byName map[string][]string
+}
+
+func newLinkIndex(files []string) linkIndex {
+	idx := linkIndex{files: make(map[string]string), byName: make(map[string][]string)}
+	for _, file := range files {
+		idx.files[strings.ToLower(file)] = file
+		name := strings.ToLower(path.Base(file))
+		idx.byName[name] = append(idx.byName[name], file)
+	}
+	return idx
+}
+
+// resolveWikilink returns the file a wikilink target refers to, or ""
+func (idx linkIndex) resolveWikilink(source, target string) string {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return ""
+	}
+	file := target
+	if path.Ext(file) == "" {
+		file += ".md"
+	}
+
+	if strings.Contains(file, "/") {
+		if found, ok := idx.files[strings.ToLower(strings.TrimPrefix(file, "/"))]; ok {
+			return found
+		}
+		if found, ok := idx.files[strings.ToLower(path.Join(path.Dir(source), file))]; ok {
+			return found
+		}
+		return ""
+	}
+
+	candidates := idx.byName[strings.ToLower(file)]
+	if len(candidates) == 0 {
+		return ""
+	}
+	// Prefer a file in the same folder, then the shortest path
+	best := candidates[0]
+	for _, c := range candidates {
+		if path.Dir(c) == path.Dir(source) {
+			return c
+		}
+		if len(c) < len(best) || (len(c) == len(best) && c < best) {
+			best = c
+		}
+	}
+	return best
+}
+
+// resolveMarkdownLink returns the file a markdown link target refers to
+// and whether it was resolved relative to the source note's folder
+func (idx linkIndex) resolveMarkdownLink(source, target string) (string, bool) {
+	if strings.HasPrefix(target, "/") {
+		return idx.files[strings.ToLower(strings.TrimPrefix(target, "/"))], false
+	}
+	if found, ok := idx.files[strings.ToLower(path.Join(path.Dir(source), target))]; ok {
+		return found, true
+	}
+	return idx.files[strings.ToLower(target)], false
+}
+
+// linkRewriter rewrites links to a moved note
+type linkRewriter struct {
+	from, to string
+	// before and after index the vault's files before and after the move
+	before, after linkIndex
+}
+
+func newLinkRewriter(files []string, from, to string) *linkRewriter {
+	moved := make([]string, 0, len(files)+1)
+	for _, file := range files {
+		if file != from {
+			moved = append(moved, file)
+		}
+	}
+	moved = append(moved, to)
+	return &linkRewriter{from: from, to: to, before: newLinkIndex(files), after: newLinkIndex(moved)}
+}
+
+// rewrite rewrites the links in the content of source and returns the new
+// content with the number of links changed, of which pinned were qualified
+// to keep pointing at their current target
+func (rw *linkRewriter) rewrite(source, content string) (updated string, count, pinned int) {
+	moved := source == rw.from
+	newSource := source
+	if moved {
+		newSource = rw.to
+	}
+
+	rewriteWiki := func(m []string) string {
+		prefix, target, anchor, alias, suffix := m[1], m[2], m[3], m[4], m[5]
+		resolved := rw.before.resolveWikilink(source, target)
+		if resolved == "" {
+			return m[0]
+		}
+		hasExt := strings.HasSuffix(strings.ToLower(target), ".md")
+
+		var newTarget string
+		switch {
+		case resolved == rw.from:
+			newTarget = strings.TrimSuffix(rw.to, ".md")
+			if name := strings.TrimSuffix(path.Base(rw.to), ".md"); !strings.Contains(target, "/") && rw.after.resolveWikilink(newSource, name) == rw.to {
+				newTarget = name
+			}
+		case rw.after.resolveWikilink(newSource, target) != resolved:
+			// The link would point at another note after the move. Files
+			// in the vault root need a leading slash to be qualified.
+			newTarget = resolved
+			if path.Ext(resolved) == ".md" {
+				newTarget = strings.TrimSuffix(resolved, ".md")
+			}
+			if !strings.Contains(newTarget, "/") {
+				newTarget = "/" + newTarget
+			}
+			pinned++
+		default:
+			return m[0]
+		}
+		if hasExt {
+			newTarget += ".md"
+		}
+		if newTarget == target {
+			return m[0]
+		}
+		count++
+		return prefix + newTarget + anchor + alias + suffix
+	}
+
+	rewriteMarkdown := func(m []string) string {
+		prefix, raw, suffix := m[1], m[2], m[3]
+		if strings.Contains(raw, "://") || strings.HasPrefix(raw, "#") || strings.HasPrefix(raw, "mailto:") {
+			return m[0]
+		}
+
+		bracketed := strings.HasPrefix(raw, "<")
+		target := strings.Trim(raw, "<>")
+		if !bracketed {
+			if decoded, err := url.PathUnescape(target); err == nil {
+				target = decoded
+			}
+		}
+		anchor := ""
+		if i := strings.Index(target, "#"); i >= 0 {
+			target, anchor = target[:i], target[i:]
+		}
+
+		file, relative := rw.before.resolveMarkdownLink(source, target)
+		if file == "" || (file != rw.from && !(moved && relative)) {
+			return m[0]
+		}
+
+		dest := file
+		if file == rw.from {
+			dest = rw.to
+		}
+		newTarget := "/" + dest
+		if !strings.HasPrefix(target, "/") {
+			newTarget = dest
+		}
+		if relative {
+			newTarget = relativePath(path.Dir(newSource), dest)
+		}
+		if newTarget == target {
+			return m[0]
+		}
+
+		count++
+		if bracketed {
+			return prefix + "<" + newTarget + anchor + ">" + suffix
+		}
+		return prefix + strings.ReplaceAll(newTarget, " ", "%20") + anchor + suffix
+	}
+
+	updated = mapOutsideCode(content, func(text string) string {
+		text = replaceSubmatches(wikilinkPattern, text, rewriteWiki)
+		return replaceSubmatches(markdownLinkPattern, text, rewriteMarkdown)
+	})
+	return updated, count, pinned
+}
+
+// replaceSubmatches replaces every match of re in text with fn's result
+func replaceSubmatches(re *regexp.Regexp, text string, fn func([]string) string) string {
+	return re.ReplaceAllStringFunc(text, func(match string) string {
+		return fn(re.FindStringSubmatch(match))
+	})
+}
+
+// mapOutsideCode applies fn to the parts of markdown content that are not
+// inside fenced code blocks or inline code spans
+func mapOutsideCode(content string, fn func(string) string) string {
+	lines := strings.SplitAfter(content, "\n")
+	var b strings.Builder
+	fence := ""
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			b.WriteString(line)
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			b.WriteString(line)
+			continue
+		}
+
+		// Alternate between text and inline code separated by backticks
+		parts := strings.Split(line, "`")
+		for i, part := range parts {
+			if i > 0 {
+				b.WriteString("`")
+			}
+			if i%2 == 0 || i == len(parts)-1 {
+				b.WriteString(fn(part))
+			} else {
+				b.WriteString(part)
+			}
+		}
+	}
+	return b.String()
+}
+
+// relativePath returns the slash-separated path of target relative to dir
+func relativePath(dir, target string) string {
+	if dir == "." || dir == "" {
+		return target
+	}
+	from := strings.Split(dir, "/")
+	to := strings.Split(target, "/")
+	i := 0
+	for i < len(from) && i < len(to)-1 && from[i] == to[i] {
+		i++
+	}
+	parts := make([]string, 0, len(from)-i+len(to)-i)
+	for range from[i:] {
+		parts = append(parts, "..")
+	}
+	parts = append(parts, to[i:]...)
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,245 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestLinkRewriterRewrite(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      []string
+		from, to   string
+		source     string
+		content    string
+		want       string
+		wantCount  int
+		wantPinned int
+	}{
+		{
+			name:  "alias and anchor",
+			files: []string{"A.md", "B.md"}, from: "A.md", to: "Sub/A2.md",
+			source: "B.md", content: "see [[A#Heading|the note]] and [[A#^block]]",
+			want: "see [[A2#Heading|the note]] and [[A2#^block]]", wantCount: 2,
+		},
+		{
+			name:  "embed",
+			files: []string{"A.md", "B.md"}, from: "A.md", to: "A2.md",
+			source: "B.md", content: "![[A]]",
+			want: "![[A2]]", wantCount: 1,
+		},
+		{
+			name:  "extension kept",
+			files: []string{"A.md", "B.md"}, from: "A.md", to: "A2.md",
+			source: "B.md", content: "[[A.md]]",
+			want: "[[A2.md]]", wantCount: 1,
+		},
+		{
+			name:  "path-qualified wikilink",
+			files: []string{"Old/A.md", "B.md"}, from: "Old/A.md", to: "New/A.md",
+			source: "B.md", content: "[[Old/A|A]]",
+			want: "[[New/A|A]]", wantCount: 1,
+		},
+		{
+			name:  "new name not unique",
+			files: []string{"A.md", "B.md", "X/Foo.md"}, from: "A.md", to: "Zz/Foo.md",
+			source: "B.md", content: "[[A]] [[Foo]]",
+			want: "[[Zz/Foo]] [[Foo]]", wantCount: 1,
+		},
+		{
+			name:  "percent-encoded markdown link",
+			files: []string{"My Notes/A b.md", "B.md"}, from: "My Notes/A b.md", to: "Arch/A b.md",
+			source: "B.md", content: "[x](My%20Notes/A%20b.md#Part)",
+			want: "[x](Arch/A%20b.md#Part)", wantCount: 1,
+		},
+		{
+			name:  "bracketed markdown link",
+			files: []string{"My Notes/A b.md", "B.md"}, from: "My Notes/A b.md", to: "Arch/A b.md",
+			source: "B.md", content: `[x](<My Notes/A b.md> "title")`,
+			want: `[x](<Arch/A b.md> "title")`, wantCount: 1,
+		},
+		{
+			name:  "code fences and spans",
+			files: []string{"A.md", "B.md"}, from: "A.md", to: "A2.md",
+			source: "B.md", content: "```\n[[A]]\n```\n`[[A]]` [[A]]\n",
+			want: "```\n[[A]]\n```\n`[[A]]` [[A2]]\n", wantCount: 1,
+		},
+		{
+			name:  "external links untouched",
+			files: []string{"A.md", "B.md"}, from: "A.md", to: "A2.md",
+			source: "B.md", content: "[web](https://example.com/A.md) [top](#A)",
+			want: "[web](https://example.com/A.md) [top](#A)",
+		},
+		{
+			name:  "ambiguous name pinned after shorter path",
+			files: []string{"A.md", "C.md", "X/Foo.md", "Y/Foo.md"}, from: "A.md", to: "Foo.md",
+			source: "C.md", content: "[[Foo|foo]]",
+			want: "[[X/Foo|foo]]", wantCount: 1, wantPinned: 1,
+		},
+		{
+			name:  "ambiguous name pinned after same folder",
+			files: []string{"A.md", "D/Note.md", "X/Foo.md"}, from: "A.md", to: "D/Foo.md",
+			source: "D/Note.md", content: "[[Foo]] [[Foo.md#H]]",
+			want: "[[X/Foo]] [[X/Foo.md#H]]", wantCount: 2, wantPinned: 2,
+		},
+		{
+			name:  "relative attachments of the moved note",
+			files: []string{"Notes/A.md", "Notes/pic.png", "Notes/files/a.pdf"}, from: "Notes/A.md", to: "Archive/2024/A.md",
+			source: "Notes/A.md", content: "![](pic.png) [pdf](files/a.pdf) [abs](/Notes/pic.png)",
+			want: "![](../../Notes/pic.png) [pdf](../../Notes/files/a.pdf) [abs](/Notes/pic.png)", wantCount: 2,
+		},
+		{
+			name:  "bare links of the moved note pinned",
+			files: []string{"A.md", "Foo.md", "D/Foo.md"}, from: "A.md", to: "D/A.md",
+			source: "A.md", content: "[[Foo]]",
+			want: "[[/Foo]]", wantCount: 1, wantPinned: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := newLinkRewriter(tt.files, tt.from, tt.to)
+			got, count, pinned := rw.rewrite(tt.source, tt.content)
+			if got != tt.want || count != tt.wantCount || pinned != tt.wantPinned {
+				t.Errorf("rewrite(%q) = %q, %d, %d; want %q, %d, %d", tt.content, got, count, pinned, tt.want, tt.wantCount, tt.wantPinned)
+			}
+		})
+	}
+}
+
+// failingVault fails to update one note
+type failingVault struct {
+	VaultBackend
+	fail string
+}
+
+func (v failingVault) UpdateNote(ctx context.Context, path, content string) (string, error) {
+	if path == v.fail {
+		return "", errors.New("disk full")
+	}
+	return v.VaultBackend.UpdateNote(ctx, path, content)
+}
+
+func TestRelocateNoteReportsNotUpdated(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"A.md": "note",
+		"B.md": "[[A]]",
+		"C.md": "[[A]]",
+	} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs, err := NewFileSystemVault(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	result, err := RelocateNote(ctx, failingVault{fs, "B.md"}, "A.md", "A2.md", RelocateOptions{})
+	if err == nil {
+		t.Fatal("RelocateNote succeeded, want an error")
+	}
+	if want := []string{"B.md"}; !reflect.DeepEqual(result.NotUpdated, want) {
+		t.Errorf("NotUpdated = %v, want %v", result.NotUpdated, want)
+	}
+	if content, _ := fs.GetNote(ctx, "C.md"); content != "[[A2]]" {
+		t.Errorf("C.md = %q, want its link updated", content)
+	}
+	if _, err := fs.GetNote(ctx, "A2.md"); err != nil {
+		t.Errorf("moved note not found: %v", err)
+	}
+}
+
+func TestRelocateNoteLocksRewrittenNotes(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"A.md": "[[B]]",
+		"B.md": "[[A]]",
+		"C.md": "[[A]]",
+		"D.md": "no links",
+	} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs, err := NewFileSystemVault(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	var locked []string
+	opts := RelocateOptions{Lock: func(notePath string) func() {
+		locked = append(locked, notePath)
+		// An edit that lands while the move waits for the lock
+		if _, err := fs.AppendNote(ctx, notePath, " edited"); err != nil {
+			t.Fatal(err)
+		}
+		return func() {}
+	}}
+	if _, err := RelocateNote(ctx, fs, "A.md", "A2.md", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(locked)
+	if want := []string{"B.md", "C.md"}; !reflect.DeepEqual(locked, want) {
+		t.Errorf("locked %v, want %v", locked, want)
+	}
+	for _, name := range []string{"B.md", "C.md"} {
+		if content, _ := fs.GetNote(ctx, name); content != "[[A2]] edited" {
+			t.Errorf("%s = %q, want its link updated and the edit kept", name, content)
+		}
+	}
+}
+
+func TestRelocateNoteSkipsUnreadable(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"A.md":         "note",
+		"B.md":         "[[A]]",
+		"Private/S.md": "[[A]]",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs, err := NewFileSystemVault(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	opts := RelocateOptions{
+		CanRead: func(notePath string) bool { return !strings.HasPrefix(notePath, "Private/") },
+		CanUpdate: func(notePath string) error {
+			if strings.HasPrefix(notePath, "Private/") {
+				t.Errorf("asked whether %s may be updated", notePath)
+			}
+			return nil
+		},
+	}
+	for _, dryRun := range []bool{true, false} {
+		opts.DryRun = dryRun
+		result, err := RelocateNote(ctx, fs, "A.md", "A2.md", opts)
+		if err != nil {
+			t.Fatalf("dry run %t: %v", dryRun, err)
+		}
+		if len(result.UpdatedNotes) != 1 || result.UpdatedNotes[0].Path != "B.md" || result.Unreadable != 1 {
+			t.Errorf("dry run %t: result %+v, want B.md updated and one unreadable note", dryRun, result)
+		}
+	}
+	if content, _ := fs.GetNote(ctx, "Private/S.md"); content != "[[A]]" {
+		t.Errorf("Private/S.md = %q, want it left alone", content)
+	}
+}
@@ -1,13 +1,20 @@
 package api
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"path"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"obsidian-mcp/search"
 )
 
 // ObsidianAPI represents the Obsidian REST API client
@@ -15,6 +22,8 @@ type ObsidianAPI struct {
 	baseURL string
 	token   string
 	client  *http.Client
+	opts    ClientOptions
+	breaker *breaker
 }
 
 // Note represents an Obsidian note
@@ -26,31 +35,163 @@ type Note struct {
 
 // VaultInfo represents vault information
 type VaultInfo struct {
-	Name         string `json:"name"`
-	Path         string `json:"path"`
-	NotesCount   int    `json:"notes_count"`
-	FoldersCount int    `json:"folders_count"`
+	Name          string            `json:"name,omitempty"`
+	Path          string            `json:"path,omitempty"`
+	Service       string            `json:"service"`
+	Authenticated bool              `json:"authenticated"`
+	Versions      map[string]string `json:"versions,omitempty"`
+	NotesCount    int               `json:"notes_count"`
+	FoldersCount  int               `json:"folders_count"`
 }
 
 // SearchResult represents a search result
 type SearchResult struct {
-	Path    string   `json:"path"`
-	Matches []string `json:"matches"`
-	Score   float64  `json:"score"`
-	Content string   `json:"content"`
+	Path    string        `json:"path"`
+	Score   float64       `json:"score"`
+	Matches []SearchMatch `json:"matches"`
+}
+
+// SearchOptions controls which search results get matches and how much
+// of each match is returned
+type SearchOptions struct {
+	// ContextLength is the number of characters of context included on
+	// each side of a match
+	ContextLength int
+	// MaxMatches is the most matches returned for a note. Scores still
+	// count every match.
+	MaxMatches int
+	// Offset and Limit are the range of results the caller will use.
+	// Backends may leave out the matches of results outside it. A Limit
+	// of 0 means all results.
+	Offset int
+	Limit  int
+	// Filter, if set, reports whether a note may be returned
+	Filter func(notePath string) bool
+}
+
+// included reports whether a note passes the filter
+func (o SearchOptions) included(notePath string) bool {
+	return o.Filter == nil || o.Filter(notePath)
+}
+
+// inPage reports whether the result at index i is in the range the caller
+// will use
+func (o SearchOptions) inPage(i int) bool {
+	return i >= o.Offset && (o.Limit == 0 || i < o.Offset+o.Limit)
+}
+
+// match returns the match of content[start:end] with ContextLength
+// characters of context on each side
+func (o SearchOptions) match(content string, start, end int) SearchMatch {
+	from, to := start, end
+	for i := 0; i < o.ContextLength && from > 0; i++ {
+		_, size := utf8.DecodeLastRuneInString(content[:from])
+		from -= size
+	}
+	for i := 0; i < o.ContextLength && to < len(content); i++ {
+		_, size := utf8.DecodeRuneInString(content[to:])
+		to += size
+	}
+	return SearchMatch{Context: content[from:to], Start: start, End: end}
+}
+
+// QueryRow is a note found by a Dataview or JsonLogic query, with the
+// values the query produced for it
+type QueryRow struct {
+	Path   string      `json:"path"`
+	Result interface{} `json:"result"`
+}
+
+// Entry types
+const (
+	EntryNote       = "note"
+	EntryAttachment = "attachment"
+	EntryFolder     = "folder"
+)
+
+// Entry is a note, attachment or folder found by ListEntries. Path is
+// relative to the listed folder. Size is in bytes and ModTime in
+// milliseconds; both are 0 for folders and when not known.
+type Entry struct {
+	Path    string `json:"path"`
+	Type    string `json:"type"`
+	Size    int64  `json:"size,omitempty"`
+	ModTime int64  `json:"mtime,omitempty"`
+}
+
+// ListOptions controls what ListEntries returns
+type ListOptions struct {
+	// Recursive lists everything below the folder instead of only its
+	// direct children
+	Recursive bool
+	// Attachments includes files that are not notes
+	Attachments bool
+	// Stats asks for the size and modification time of every file,
+	// which backends that don't have them at hand fetch per file
+	Stats bool
+}
+
+// SearchMatch is a single match within a note. Start and End are byte
+// offsets of the matched text within the note content.
+type SearchMatch struct {
+	Context string `json:"context"`
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+}
+
+// ClientOptions configures the Obsidian API client
+type ClientOptions struct {
+	// Timeout limits each HTTP request, including reading the response.
+	// Zero means no limit.
+	Timeout time.Duration
+	// MaxRetries is how often idempotent requests (GET, PUT, DELETE) are
+	// retried after connection errors and 5xx responses
+	MaxRetries int
+	// RetryBaseDelay is the delay before the first retry. It doubles with
+	// every retry up to RetryMaxDelay and is jittered.
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// BreakerThreshold is the number of consecutive failed requests after
+	// which requests fail fast with ErrUnavailable. Zero disables it.
+	BreakerThreshold int
+	// BreakerCooldown is how long requests fail fast before a probe
+	// request checks whether Obsidian is back
+	BreakerCooldown time.Duration
+	// CACertFile is a PEM bundle of CAs trusted for the HTTPS port, such
+	// as the plugin's own certificate
+	CACertFile string
+	// CertFingerprint pins the server certificate by its SHA-256
+	// fingerprint in hex
+	CertFingerprint string
+	// InsecureSkipVerify disables certificate verification entirely
+	InsecureSkipVerify bool
 }
 
 // NewObsidianAPI creates a new Obsidian API client
-func NewObsidianAPI(baseURL, token string) *ObsidianAPI {
+func NewObsidianAPI(baseURL, token string, opts ClientOptions) (*ObsidianAPI, error) {
+	client := &http.Client{Timeout: opts.Timeout}
+
+	tlsConfig, err := tlsConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		client.Transport = transport
+	}
+
 	return &ObsidianAPI{
 		baseURL: strings.TrimRight(baseURL, "/"),
 		token:   token,
-		client:  &http.Client{},
-	}
+		client:  client,
+		opts:    opts,
+		breaker: newBreaker(opts.BreakerThreshold, opts.BreakerCooldown),
+	}, nil
 }
 
-// normalizeNotePath ensures the path has .md extension if it's a note
-func normalizeNotePath(path string) string {
+// NormalizeNotePath ensures the path has .md extension if it's a note
+func NormalizeNotePath(path string) string {
 	// Don't add .md if path is empty or already has an extension
 	if path == "" || strings.Contains(path, ".") {
 		return path
@@ -59,74 +200,109 @@ func normalizeNotePath(path string) string {
 	return path + ".md"
 }
 
-func (api *ObsidianAPI) makeRequest(method, endpoint string, body interface{}) (*http.Response, error) {
-	var bodyReader io.Reader
+func (api *ObsidianAPI) makeRequest(ctx context.Context, method, endpoint string, body interface{}) (*http.Response, error) {
+	var content string
 
 	if body != nil {
 		jsonBody, err := json.Marshal(body)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal request body: %v", err)
 		}
-		bodyReader = bytes.NewBuffer(jsonBody)
+		content = string(jsonBody)
 	}
 
-	req, err := http.NewRequest(method, api.baseURL+endpoint, bodyReader)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
-	}
+	return api.makeContentRequest(ctx, method, endpoint, "application/json", content, nil)
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	if api.token != "" {
-		req.Header.Set("Authorization", "Bearer "+api.token)
-	}
+func (api *ObsidianAPI) makeTextRequest(ctx context.Context, method, endpoint string, content string) (*http.Response, error) {
+	return api.makeContentRequest(ctx, method, endpoint, "text/markdown", content, nil)
+}
 
-	resp, err := api.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %v", err)
+// makeContentRequest sends a request, retrying idempotent requests after
+// connection errors and 5xx responses. The last response is returned even
+// if it is a 5xx, so callers report its status as usual. A rejected
+// certificate fails at once without counting towards the breaker.
+func (api *ObsidianAPI) makeContentRequest(ctx context.Context, method, endpoint, contentType, content string, headers map[string]string) (*http.Response, error) {
+	attempts := 1
+	if idempotent(method) {
+		attempts += api.opts.MaxRetries
 	}
 
-	return resp, nil
+	for attempt := 0; ; attempt++ {
+		if err := api.breaker.allow(); err != nil {
+			return nil, err
+		}
+
+		resp, err := api.sendRequest(ctx, method, endpoint, contentType, content, headers)
+		switch {
+		case err != nil && (contextError(ctx) != nil || errors.Is(err, ErrCertificate)):
+			api.breaker.abandoned()
+			return nil, err
+		case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+			api.breaker.failed()
+		default:
+			api.breaker.succeeded()
+			return resp, nil
+		}
+
+		if attempt+1 >= attempts {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := sleep(ctx, backoff(attempt, api.opts.RetryBaseDelay, api.opts.RetryMaxDelay)); err != nil {
+			return nil, err
+		}
+	}
 }
 
-func (api *ObsidianAPI) makeTextRequest(method, endpoint string, content string) (*http.Response, error) {
+// sendRequest sends a single request
+func (api *ObsidianAPI) sendRequest(ctx context.Context, method, endpoint, contentType, content string, headers map[string]string) (*http.Response, error) {
 	var bodyReader io.Reader
 
 	if content != "" {
 		bodyReader = strings.NewReader(content)
 	}
 
-	req, err := http.NewRequest(method, api.baseURL+endpoint, bodyReader)
+	req, err := http.NewRequestWithContext(ctx, method, api.baseURL+endpoint, bodyReader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
 
-	req.Header.Set("Content-Type", "text/markdown")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
 	if api.token != "" {
 		req.Header.Set("Authorization", "Bearer "+api.token)
 	}
 
 	resp, err := api.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %v", err)
+		return nil, requestError(ctx, err)
 	}
 
 	return resp, nil
 }
 
-// GetNote retrieves a note by its path
-func (api *ObsidianAPI) GetNote(path string) (string, error) {
+// GetNote retrieves the content of a note by its path
+func (api *ObsidianAPI) GetNote(ctx context.Context, path string) (string, error) {
 	// Normalize path to ensure .md extension
-	path = normalizeNotePath(path)
+	path = NormalizeNotePath(path)
 	endpoint := fmt.Sprintf("/vault/%s", url.PathEscape(path))
 
-	resp, err := api.makeRequest("GET", endpoint, nil)
+	resp, err := api.makeRequest(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to get note: %s", resp.Status)
+		return "", fmt.Errorf("failed to get note: %w", statusError(resp))
 	}
 
 	// Read the plain text content
@@ -135,192 +311,344 @@ func (api *ObsidianAPI) GetNote(path string) (string, error) {
 		return "", fmt.Errorf("failed to read response: %v", err)
 	}
 
-	result := fmt.Sprintf("# Note: %s\n\n%s", path, string(content))
-
-	return result, nil
+	return string(content), nil
 }
 
 // CreateNote creates a new note
-func (api *ObsidianAPI) CreateNote(path, content string) (string, error) {
+func (api *ObsidianAPI) CreateNote(ctx context.Context, path, content string) (string, error) {
 	// Normalize path to ensure .md extension
-	path = normalizeNotePath(path)
+	path = NormalizeNotePath(path)
 	endpoint := fmt.Sprintf("/vault/%s", url.PathEscape(path))
 
-	resp, err := api.makeTextRequest("PUT", endpoint, content)
+	resp, err := api.makeTextRequest(ctx, "PUT", endpoint, content)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
-		return "", fmt.Errorf("failed to create note: %s", resp.Status)
+		return "", fmt.Errorf("failed to create note: %w", statusError(resp))
 	}
 
 	return fmt.Sprintf("Successfully created note: %s", path), nil
 }
 
 // UpdateNote updates an existing note
-func (api *ObsidianAPI) UpdateNote(path, content string) (string, error) {
+func (api *ObsidianAPI) UpdateNote(ctx context.Context, path, content string) (string, error) {
 	// Normalize path to ensure .md extension
-	path = normalizeNotePath(path)
+	path = NormalizeNotePath(path)
 	endpoint := fmt.Sprintf("/vault/%s", url.PathEscape(path))
 
-	resp, err := api.makeTextRequest("PUT", endpoint, content)
+	resp, err := api.makeTextRequest(ctx, "PUT", endpoint, content)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		return "", fmt.Errorf("failed to update note: %s", resp.Status)
+		return "", fmt.Errorf("failed to update note: %w", statusError(resp))
 	}
 
 	return fmt.Sprintf("Successfully updated note: %s", path), nil
 }
 
+// AppendNote appends content to the end of a note, creating it if needed
+func (api *ObsidianAPI) AppendNote(ctx context.Context, path, content string) (string, error) {
+	path = NormalizeNotePath(path)
+	endpoint := fmt.Sprintf("/vault/%s", url.PathEscape(path))
+
+	resp, err := api.makeTextRequest(ctx, "POST", endpoint, content)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return "", fmt.Errorf("failed to append to note: %w", statusError(resp))
+	}
+
+	return fmt.Sprintf("Successfully appended to note: %s", path), nil
+}
+
+// PatchNote edits the section of a note below a heading, a block reference
+// or a frontmatter key
+func (api *ObsidianAPI) PatchNote(ctx context.Context, path string, patch Patch) (string, error) {
+	if err := patch.Validate(); err != nil {
+		return "", err
+	}
+
+	path = NormalizeNotePath(path)
+	endpoint := fmt.Sprintf("/vault/%s", url.PathEscape(path))
+
+	contentType := "text/markdown"
+	if patch.TargetType == TargetFrontmatter {
+		contentType = "application/json"
+	}
+	headers := map[string]string{
+		"Operation":        patch.Operation,
+		"Target-Type":      patch.TargetType,
+		"Target":           url.PathEscape(patch.Target),
+		"Target-Delimiter": headingDelimiter,
+	}
+	if patch.CreateTargetIfMissing {
+		headers["Create-Target-If-Missing"] = "true"
+	}
+
+	resp, err := api.makeContentRequest(ctx, "PATCH", endpoint, contentType, patch.Content, headers)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("failed to patch note: %w - %s", statusError(resp), string(bodyBytes))
+	}
+
+	return fmt.Sprintf("Successfully patched note: %s (%s %s %q)", path, patch.Operation, patch.TargetType, patch.Target), nil
+}
+
 // DeleteNote deletes a note
-func (api *ObsidianAPI) DeleteNote(path string) (string, error) {
+func (api *ObsidianAPI) DeleteNote(ctx context.Context, path string) (string, error) {
 	// Normalize path to ensure .md extension
-	path = normalizeNotePath(path)
+	path = NormalizeNotePath(path)
 	endpoint := fmt.Sprintf("/vault/%s", url.PathEscape(path))
 
-	resp, err := api.makeRequest("DELETE", endpoint, nil)
+	resp, err := api.makeRequest(ctx, "DELETE", endpoint, nil)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		return "", fmt.Errorf("failed to delete note: %s", resp.Status)
+		return "", fmt.Errorf("failed to delete note: %w", statusError(resp))
 	}
 
 	return fmt.Sprintf("Successfully deleted note: %s", path), nil
 }
 
-// ListNotes lists all notes in the vault or a specific folder
-func (api *ObsidianAPI) ListNotes(folder string) (string, error) {
+// MoveNote moves a note by copying its content to the new path and
+// deleting the original, as the REST API has no rename endpoint
+func (api *ObsidianAPI) MoveNote(ctx context.Context, from, to string) (string, error) {
+	from = NormalizeNotePath(from)
+	to = NormalizeNotePath(to)
+
+	content, err := api.GetNote(ctx, from)
+	if err != nil {
+		return "", fmt.Errorf("failed to move note: %w", err)
+	}
+	if _, err := api.CreateNote(ctx, to, content); err != nil {
+		return "", fmt.Errorf("failed to move note: %w", err)
+	}
+	if _, err := api.DeleteNote(ctx, from); err != nil {
+		return "", fmt.Errorf("failed to move note: copied to %s but %w", to, err)
+	}
+
+	return fmt.Sprintf("Successfully moved note: %s -> %s", from, to), nil
+}
+
+// ListNotes lists the notes directly inside the vault root or a folder
+func (api *ObsidianAPI) ListNotes(ctx context.Context, folder string) ([]string, error) {
+	names, err := api.listFolder(ctx, folder)
+	if err != nil {
+		return nil, err
+	}
+
+	notes := []string{}
+	for _, name := range names {
+		if strings.HasSuffix(name, ".md") {
+			notes = append(notes, name)
+		}
+	}
+
+	return notes, nil
+}
+
+// listFolder returns the names of the files and folders directly inside
+// the vault root or a folder. Folder names end with a slash.
+func (api *ObsidianAPI) listFolder(ctx context.Context, folder string) ([]string, error) {
 	endpoint := "/vault/"
 	if folder != "" {
 		endpoint = fmt.Sprintf("/vault/%s/", url.PathEscape(folder))
 	}
 
-	resp, err := api.makeRequest("GET", endpoint, nil)
+	resp, err := api.makeRequest(ctx, "GET", endpoint, nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	// Handle 404 for empty/non-existent folders - return empty list instead of error
 	if resp.StatusCode == http.StatusNotFound {
-		if folder != "" {
-			return fmt.Sprintf("Folder '%s' is empty or does not exist yet. No notes found.", folder), nil
-		}
-		return "No notes found in vault.", nil
+		return []string{}, nil
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to list notes: %s", resp.Status)
+		return nil, fmt.Errorf("failed to list notes: %w", statusError(resp))
 	}
 
 	var files map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&files); err != nil {
-		return "", fmt.Errorf("failed to decode response: %v", err)
+		return nil, fmt.Errorf("failed to decode response: %v", err)
 	}
 
-	var notes []string
+	names := []string{}
 	if filesList, ok := files["files"].([]interface{}); ok {
 		for _, file := range filesList {
 			// Handle both string and object formats
 			if fileStr, ok := file.(string); ok {
-				if strings.HasSuffix(fileStr, ".md") {
-					notes = append(notes, fileStr)
-				}
+				names = append(names, fileStr)
 			} else if fileInfo, ok := file.(map[string]interface{}); ok {
 				if path, ok := fileInfo["path"].(string); ok {
-					if strings.HasSuffix(path, ".md") {
-						notes = append(notes, path)
-					}
+					names = append(names, path)
 				}
 			}
 		}
 	}
 
-	if len(notes) == 0 {
-		return "No notes found.", nil
-	}
+	return names, nil
+}
 
-	result := fmt.Sprintf("Found %d notes:\n", len(notes))
-	for _, note := range notes {
-		result += fmt.Sprintf("- %s\n", note)
+// ListEntries lists the folders, notes and, if asked for, attachments in
+// the vault root or a folder. Sizes and modification times are only set
+// when opts.Stats asks for them, as each takes a request per file.
+func (api *ObsidianAPI) ListEntries(ctx context.Context, folder string, opts ListOptions) ([]Entry, error) {
+	entries := []Entry{}
+	if err := api.listEntries(ctx, folder, "", opts, &entries); err != nil {
+		return nil, err
 	}
-
-	return result, nil
+	// Subfolders are listed with the same context, so a cancelled listing
+	// would otherwise look complete
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	return entries, nil
 }
 
-// SearchNotes searches for notes containing specific text
-func (api *ObsidianAPI) SearchNotes(query string) (string, error) {
-	// Use simple search endpoint
-	endpoint := fmt.Sprintf("/search/simple/?query=%s&contextLength=100", url.QueryEscape(query))
-
-	req, err := http.NewRequest("POST", api.baseURL+endpoint, nil)
+// listEntries appends the entries of folder/prefix to entries, with paths
+// relative to folder
+func (api *ObsidianAPI) listEntries(ctx context.Context, folder, prefix string, opts ListOptions, entries *[]Entry) error {
+	names, err := api.listFolder(ctx, path.Join(folder, prefix))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
+		return err
 	}
 
-	if api.token != "" {
-		req.Header.Set("Authorization", "Bearer "+api.token)
+	for _, name := range names {
+		if isHidden(name) {
+			// Skip .obsidian, .trash and other hidden files and folders
+			continue
+		}
+		if strings.HasSuffix(name, "/") {
+			entryPath := path.Join(prefix, strings.TrimSuffix(name, "/"))
+			*entries = append(*entries, Entry{Path: entryPath, Type: EntryFolder})
+			if opts.Recursive {
+				if err := api.listEntries(ctx, folder, entryPath, opts, entries); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		entry := Entry{Path: path.Join(prefix, name), Type: EntryNote}
+		if !strings.HasSuffix(name, ".md") {
+			if !opts.Attachments {
+				continue
+			}
+			entry.Type = EntryAttachment
+		}
+		if opts.Stats {
+			// Files that can't be read keep an unknown size and time
+			if stat, err := api.fileStat(ctx, path.Join(folder, entry.Path)); err == nil {
+				entry.Size = stat.Size
+				entry.ModTime = stat.Mtime
+			}
+		}
+		*entries = append(*entries, entry)
 	}
+	return nil
+}
 
-	resp, err := api.client.Do(req)
+// Content types of the queries accepted by the /search/ endpoint
+const (
+	contentTypeDQL       = "application/vnd.olrapi.dataview.dql+txt"
+	contentTypeJSONLogic = "application/vnd.olrapi.jsonlogic+json"
+)
+
+// QueryDataview runs a Dataview DQL query, which needs the Dataview plugin
+// in Obsidian, and returns a row per note with the values of its columns
+func (api *ObsidianAPI) QueryDataview(ctx context.Context, query string) ([]QueryRow, error) {
+	return api.runQuery(ctx, contentTypeDQL, query)
+}
+
+// QueryJSONLogic returns the notes for which a JsonLogic expression,
+// evaluated against each note's path, content, frontmatter, tags and stat,
+// gives a truthy result
+func (api *ObsidianAPI) QueryJSONLogic(ctx context.Context, logic string) ([]QueryRow, error) {
+	return api.runQuery(ctx, contentTypeJSONLogic, logic)
+}
+
+// runQuery posts a query to the /search/ endpoint. Queries that Obsidian
+// rejects fail with search.ErrInvalidQuery and the reason it gave.
+func (api *ObsidianAPI) runQuery(ctx context.Context, contentType, query string) ([]QueryRow, error) {
+	resp, err := api.makeContentRequest(ctx, "POST", "/search/", contentType, query, nil)
 	if err != nil {
-		return "", fmt.Errorf("search request failed: %v", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusBadRequest {
+		var failure struct {
+			Message string `json:"message"`
+		}
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(bodyBytes, &failure) != nil || failure.Message == "" {
+			failure.Message = string(bodyBytes)
+		}
+		return nil, &kindError{search.ErrInvalidQuery, fmt.Errorf("query rejected by Obsidian: %s", failure.Message)}
+	}
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("failed to search notes: %s - %s", resp.Status, string(bodyBytes))
+		return nil, fmt.Errorf("failed to run query: %w - %s", statusError(resp), string(bodyBytes))
 	}
 
-	var searchResults []map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&searchResults); err != nil {
-		return "", fmt.Errorf("failed to decode response: %v", err)
+	var items []struct {
+		Filename string      `json:"filename"`
+		Result   interface{} `json:"result"`
 	}
-
-	if len(searchResults) == 0 {
-		return fmt.Sprintf("No notes found matching \"%s\".", query), nil
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
 	}
 
-	result := fmt.Sprintf("Found %d notes matching \"%s\":\n\n", len(searchResults), query)
-	for i, item := range searchResults {
-		if filename, ok := item["filename"].(string); ok {
-			result += fmt.Sprintf("%d. **%s**\n", i+1, filename)
-
-			// Add context from matches
-			if matches, ok := item["matches"].([]interface{}); ok && len(matches) > 0 {
-				for _, match := range matches {
-					if matchMap, ok := match.(map[string]interface{}); ok {
-						if context, ok := matchMap["context"].(string); ok {
-							result += fmt.Sprintf("   > %s\n", strings.TrimSpace(context))
-						}
-					}
-				}
-			}
-			result += "\n"
-		}
+	rows := make([]QueryRow, 0, len(items))
+	for _, item := range items {
+		rows = append(rows, QueryRow{Path: item.Filename, Result: item.Result})
 	}
+	return rows, nil
+}
 
-	return result, nil
+// ListAllNotes lists the paths of every note in the vault
+func (api *ObsidianAPI) ListAllNotes(ctx context.Context) ([]string, error) {
+	allFiles := []string{}
+	folders := make(map[string]bool)
+	if err := api.countVaultFiles(ctx, "", &allFiles, &folders); err != nil {
+		return nil, fmt.Errorf("failed to list notes: %w", err)
+	}
+	// Subfolders that fail to list are skipped, so a cancelled listing
+	// would otherwise look complete
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	return allFiles, nil
 }
 
 // countVaultFiles recursively counts all markdown files and folders
-func (api *ObsidianAPI) countVaultFiles(path string, allFiles *[]string, folders *map[string]bool) error {
+func (api *ObsidianAPI) countVaultFiles(ctx context.Context, path string, allFiles *[]string, folders *map[string]bool) error {
 	endpoint := "/vault/"
 	if path != "" {
 		endpoint = "/vault/" + path + "/"
 	}
 
-	resp, err := api.makeRequest("GET", endpoint, nil)
+	resp, err := api.makeRequest(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return err
 	}
@@ -332,7 +660,7 @@ func (api *ObsidianAPI) countVaultFiles(path string, allFiles *[]string, folders
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to list files in %s: %s", path, resp.Status)
+		return fmt.Errorf("failed to list files in %s: %w", path, statusError(resp))
 	}
 
 	var files map[string]interface{}
@@ -347,6 +675,10 @@ func (api *ObsidianAPI) countVaultFiles(path string, allFiles *[]string, folders
 				if strings.HasSuffix(filename, "/") {
 					// It's a folder - remove trailing slash for storage
 					folderName := strings.TrimSuffix(filename, "/")
+					if isHidden(folderName) {
+						// Skip .obsidian, .trash and other hidden folders
+						continue
+					}
 					fullPath := folderName
 					if path != "" {
 						fullPath = path + "/" + folderName
@@ -354,7 +686,7 @@ func (api *ObsidianAPI) countVaultFiles(path string, allFiles *[]string, folders
 
 					// Mark folder and recurse into it
 					(*folders)[fullPath] = true
-					api.countVaultFiles(fullPath, allFiles, folders)
+					api.countVaultFiles(ctx, fullPath, allFiles, folders)
 				} else if strings.HasSuffix(filename, ".md") {
 					// It's a markdown file
 					fullPath := filename
@@ -371,36 +703,36 @@ func (api *ObsidianAPI) countVaultFiles(path string, allFiles *[]string, folders
 }
 
 // GetVaultInfo gets information about the vault
-func (api *ObsidianAPI) GetVaultInfo() (string, error) {
-	resp, err := api.makeRequest("GET", "/", nil)
+func (api *ObsidianAPI) GetVaultInfo(ctx context.Context) (VaultInfo, error) {
+	resp, err := api.makeRequest(ctx, "GET", "/", nil)
 	if err != nil {
-		return "", err
+		return VaultInfo{}, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to get vault info: %s", resp.Status)
+		return VaultInfo{}, fmt.Errorf("failed to get vault info: %w", statusError(resp))
 	}
 
 	var info map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
-		return "", fmt.Errorf("failed to decode response: %v", err)
+		return VaultInfo{}, fmt.Errorf("failed to decode response: %v", err)
 	}
 
-	result := "# Vault Information\n\n"
+	var result VaultInfo
 
 	if authenticated, ok := info["authenticated"].(bool); ok {
-		result += fmt.Sprintf("**Authenticated:** %v\n", authenticated)
+		result.Authenticated = authenticated
 	}
 
 	if service, ok := info["service"].(string); ok {
-		result += fmt.Sprintf("**Service:** %s\n", service)
+		result.Service = service
 	}
 
 	if versions, ok := info["versions"].(map[string]interface{}); ok {
-		result += "\n## Versions\n"
+		result.Versions = make(map[string]string, len(versions))
 		for key, value := range versions {
-			result += fmt.Sprintf("- **%s:** %v\n", key, value)
+			result.Versions[key] = fmt.Sprint(value)
 		}
 	}
 
@@ -408,11 +740,151 @@ func (api *ObsidianAPI) GetVaultInfo() (string, error) {
 	allFiles := []string{}
 	folders := make(map[string]bool)
 
-	if err := api.countVaultFiles("", &allFiles, &folders); err == nil {
-		result += "\n## Statistics\n"
-		result += fmt.Sprintf("- **Notes:** %d\n", len(allFiles))
-		result += fmt.Sprintf("- **Folders:** %d\n", len(folders))
+	if err := api.countVaultFiles(ctx, "", &allFiles, &folders); err == nil {
+		result.NotesCount = len(allFiles)
+		result.FoldersCount = len(folders)
 	}
 
 	return result, nil
 }
+
+// noteJSONType requests a note with its metadata instead of its content
+const noteJSONType = "application/vnd.olrapi.note+json"
+
+// fileStat is the size in bytes and modification time in milliseconds
+// of a vault file, as reported by the Local REST API
+type fileStat struct {
+	Mtime int64 `json:"mtime"`
+	Size  int64 `json:"size"`
+}
+
+// fileStat returns the size and modification time of a note or attachment
+func (api *ObsidianAPI) fileStat(ctx context.Context, path string) (fileStat, error) {
+	endpoint := fmt.Sprintf("/vault/%s", url.PathEscape(path))
+	headers := map[string]string{"Accept": noteJSONType}
+
+	resp, err := api.makeContentRequest(ctx, "GET", endpoint, "application/json", "", headers)
+	if err != nil {
+		return fileStat{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fileStat{}, fmt.Errorf("failed to get note metadata: %w", statusError(resp))
+	}
+
+	var note struct {
+		Stat fileStat `json:"stat"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&note); err != nil {
+		return fileStat{}, fmt.Errorf("failed to decode note metadata: %v", err)
+	}
+
+	return note.Stat, nil
+}
+
+// statWorkers is how many note metadata requests NoteModTimes sends at
+// once, as the Local REST API lists files without their metadata
+const statWorkers = 8
+
+// NoteModTimes returns the modification time of every note in the vault
+// in milliseconds, fetching the metadata of each note. Notes deleted since
+// the listing are left out, and notes whose metadata can't be fetched get
+// a modification time of 0.
+func (api *ObsidianAPI) NoteModTimes(ctx context.Context) (map[string]int64, error) {
+	notes, err := api.ListAllNotes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	times := make(map[string]int64, len(notes))
+	queue := make(chan string)
+	for range min(statWorkers, len(notes)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for note := range queue {
+				stat, err := api.fileStat(ctx, note)
+				if errors.Is(err, ErrNotFound) {
+					continue
+				}
+				// stat is zero when the metadata couldn't be fetched
+				mu.Lock()
+				times[note] = stat.Mtime
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, note := range notes {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- note
+	}
+	close(queue)
+	wg.Wait()
+
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	return times, nil
+}
+
+// Watch reports changes to notes by polling the vault listing and
+// comparing modification times, as the Local REST API has no change events.
+// It returns at once when opts.PollInterval is zero.
+func (api *ObsidianAPI) Watch(ctx context.Context, opts WatchOptions, fn func([]NoteChange)) error {
+	if opts.PollInterval <= 0 {
+		return nil
+	}
+
+	changes := make(chan NoteChange)
+	go debounceChanges(ctx, changes, opts, fn)
+
+	// previous stays nil until the vault could be listed once, so notes
+	// that exist when Obsidian becomes reachable are not reported
+	var previous map[string]int64
+	poll := func() {
+		current, err := api.NoteModTimes(ctx)
+		if err != nil {
+			return
+		}
+		if previous != nil {
+			for path, mtime := range current {
+				old, ok := previous[path]
+				switch {
+				case !ok:
+					sendChange(ctx, changes, path, NoteCreated)
+				case mtime == 0:
+					// The note couldn't be stat'ed this time; keep the
+					// last known time so it isn't reported as modified
+					current[path] = old
+				case old != 0 && mtime != old:
+					sendChange(ctx, changes, path, NoteModified)
+				}
+			}
+			for path := range previous {
+				if _, ok := current[path]; !ok {
+					sendChange(ctx, changes, path, NoteDeleted)
+				}
+			}
+		}
+		previous = current
+	}
+
+	ticker := time.NewTicker(opts.PollInterval)
+	defer ticker.Stop()
+
+	poll()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			poll()
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestObsidianNoteModTimesSkipsFailedStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/vault/":
+			w.Write([]byte(`{"files": ["a.md", "b.md", "gone.md"]}`))
+		case "/vault/a.md":
+			w.Write([]byte(`{"stat": {"mtime": 123, "size": 4}}`))
+		case "/vault/b.md":
+			http.Error(w, "broken", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	api, err := NewObsidianAPI(server.URL, "token", ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	times, err := api.NoteModTimes(context.Background())
+	if err != nil {
+		t.Fatalf("NoteModTimes() error = %v", err)
+	}
+	if want := map[string]int64{"a.md": 123, "b.md": 0}; !reflect.DeepEqual(times, want) {
+		t.Errorf("NoteModTimes() = %v, want %v", times, want)
+	}
+}
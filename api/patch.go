@@ -0,0 +1,350 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Patch operations, matching the Local REST API's Operation header
+const (
+	PatchAppend  = "append"
+	PatchPrepend = "prepend"
+	PatchReplace = "replace"
+)
+
+// Patch target types, matching the Local REST API's Target-Type header
+const (
+	TargetHeading     = "heading"
+	TargetBlock       = "block"
+	TargetFrontmatter = "frontmatter"
+)
+
+// headingDelimiter separates nested headings in a heading target
+const headingDelimiter = "::"
+
+// headingPattern matches an ATX markdown heading
+var headingPattern = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+
+// listItemPattern matches the indentation, bullet or number and task
+// checkbox that start a list item
+var listItemPattern = regexp.MustCompile(`^[ \t]*(?:[-*+]|\d{1,9}[.)])(?:[ \t]+\[.\])?(?:[ \t]+|$)`)
+
+// Patch describes a section-targeted edit of a note
+type Patch struct {
+	// Operation is append, prepend or replace
+	Operation string
+	// TargetType is heading, block or frontmatter
+	TargetType string
+	// Target is a heading path such as "Tasks::Today", a block reference
+	// id, or a frontmatter key
+	Target string
+	// Content is markdown for heading and block targets, and a JSON value
+	// for frontmatter targets
+	Content string
+	// CreateTargetIfMissing adds the heading or frontmatter key when it
+	// does not exist yet instead of failing
+	CreateTargetIfMissing bool
+}
+
+// Validate checks that the patch operation and target are well formed
+func (p Patch) Validate() error {
+	switch p.Operation {
+	case PatchAppend, PatchPrepend, PatchReplace:
+	default:
+		return invalidPatch("invalid operation %q (expected %s, %s or %s)", p.Operation, PatchAppend, PatchPrepend, PatchReplace)
+	}
+	switch p.TargetType {
+	case TargetHeading, TargetBlock, TargetFrontmatter:
+	default:
+		return invalidPatch("invalid target type %q (expected %s, %s or %s)", p.TargetType, TargetHeading, TargetBlock, TargetFrontmatter)
+	}
+	if strings.TrimSpace(p.Target) == "" {
+		return invalidPatch("target is required")
+	}
+	if p.TargetType == TargetFrontmatter && !json.Valid([]byte(p.Content)) {
+		return invalidPatch("frontmatter content must be a JSON value")
+	}
+	return nil
+}
+
+// invalidPatch describes a malformed patch as ErrInvalidArgument
+func invalidPatch(format string, args ...any) error {
+	return &kindError{ErrInvalidArgument, fmt.Errorf(format, args...)}
+}
+
+// ApplyPatch applies a patch to note content the same way the Local REST
+// API does, for backends that edit files directly
+func ApplyPatch(content string, patch Patch) (string, error) {
+	if err := patch.Validate(); err != nil {
+		return "", err
+	}
+
+	switch patch.TargetType {
+	case TargetHeading:
+		return patchHeading(content, patch)
+	case TargetBlock:
+		return patchBlock(content, patch)
+	default:
+		return patchFrontmatter(content, patch)
+	}
+}
+
+// splitLines splits content into lines, keeping line endings
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.SplitAfter(content, "\n")
+}
+
+// ensureNewline terminates text with a newline
+func ensureNewline(text string) string {
+	if text == "" || strings.HasSuffix(text, "\n") {
+		return text
+	}
+	return text + "\n"
+}
+
+// spliceLines replaces lines[start:end] with text
+func spliceLines(lines []string, start, end int, text string) string {
+	var b strings.Builder
+	for _, line := range lines[:start] {
+		b.WriteString(line)
+	}
+	if start > 0 && !strings.HasSuffix(lines[start-1], "\n") {
+		b.WriteString("\n")
+	}
+	b.WriteString(text)
+	for _, line := range lines[end:] {
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// findHeading returns the line index of the heading addressed by path, and
+// the index of the line that ends its section. Lines in code blocks and the
+// frontmatter are not headings.
+func findHeading(lines []string, path []string) (heading, end int, found bool) {
+	type entry struct {
+		level int
+		text  string
+	}
+	var stack []entry
+	fence := ""
+	heading = -1
+	headingLevel := 0
+
+	start := 0
+	if _, body, ok := splitFrontmatter(strings.Join(lines, "")); ok {
+		start = len(lines) - len(splitLines(body))
+	}
+
+	for i := start; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+
+		m := headingPattern.FindStringSubmatch(strings.TrimRight(line, "\r\n"))
+		if m == nil {
+			continue
+		}
+		level := len(m[1])
+
+		if heading >= 0 && level <= headingLevel {
+			return heading, i, true
+		}
+
+		for len(stack) > 0 && stack[len(stack)-1].level >= level {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, entry{level, m[2]})
+
+		if heading < 0 && len(stack) == len(path) {
+			match := true
+			for j := range path {
+				if strings.TrimSpace(path[j]) != stack[j].text {
+					match = false
+					break
+				}
+			}
+			if match {
+				heading, headingLevel = i, level
+			}
+		}
+	}
+
+	if heading >= 0 {
+		return heading, len(lines), true
+	}
+	return -1, -1, false
+}
+
+// patchHeading edits the section below a heading
+func patchHeading(content string, patch Patch) (string, error) {
+	lines := splitLines(content)
+	path := strings.Split(patch.Target, headingDelimiter)
+	heading, end, found := findHeading(lines, path)
+	text := ensureNewline(patch.Content)
+
+	if !found {
+		if !patch.CreateTargetIfMissing {
+			return "", fmt.Errorf("heading %q %w", patch.Target, ErrNotFound)
+		}
+		return createHeading(lines, path, text), nil
+	}
+
+	switch patch.Operation {
+	case PatchPrepend:
+		return spliceLines(lines, heading+1, heading+1, text), nil
+	case PatchReplace:
+		return spliceLines(lines, heading+1, end, text), nil
+	default:
+		// Append after the last non-blank line so spacing before the next
+		// heading is kept
+		insert := end
+		for insert > heading+1 && strings.TrimSpace(lines[insert-1]) == "" {
+			insert--
+		}
+		return spliceLines(lines, insert, insert, text), nil
+	}
+}
+
+// createHeading adds the headings of path that are missing at the end of
+// the section of the deepest one that exists, or at the end of the note,
+// each one level below its parent, followed by text
+func createHeading(lines []string, path []string, text string) string {
+	insert, level, depth := len(lines), 0, len(path)-1
+	for ; depth > 0; depth-- {
+		if heading, end, found := findHeading(lines, path[:depth]); found {
+			level = len(headingPattern.FindStringSubmatch(strings.TrimRight(lines[heading], "\r\n"))[1])
+			insert = end
+			break
+		}
+	}
+	// Insert after the last non-blank line so spacing before the next
+	// heading is kept
+	for insert > 0 && strings.TrimSpace(lines[insert-1]) == "" {
+		insert--
+	}
+
+	var b strings.Builder
+	if insert > 0 {
+		b.WriteString("\n")
+	}
+	for i, name := range path[depth:] {
+		fmt.Fprintf(&b, "%s %s\n", strings.Repeat("#", min(level+i+1, 6)), strings.TrimSpace(name))
+	}
+	b.WriteString(text)
+	if insert < len(lines) && strings.TrimSpace(lines[insert]) != "" {
+		b.WriteString("\n")
+	}
+	return spliceLines(lines, insert, insert, b.String())
+}
+
+// patchBlock edits the block ending with a ^id block reference. The block
+// is the paragraph or list item containing the reference.
+func patchBlock(content string, patch Patch) (string, error) {
+	lines := splitLines(content)
+	id := strings.TrimPrefix(strings.TrimSpace(patch.Target), "^")
+	marker := regexp.MustCompile(`\s\^` + regexp.QuoteMeta(id) + `\s*$`)
+
+	last := -1
+	for i, line := range lines {
+		if marker.MatchString(strings.TrimRight(line, "\r\n")) {
+			last = i
+			break
+		}
+	}
+	if last < 0 {
+		return "", fmt.Errorf("block ^%s %w", id, ErrNotFound)
+	}
+
+	// A block in a list starts at its item's marker, other blocks at the
+	// start of their paragraph
+	first := last
+	for first > 0 && !listItemPattern.MatchString(lines[first]) {
+		previous := strings.TrimRight(lines[first-1], "\r\n")
+		if strings.TrimSpace(previous) == "" || headingPattern.MatchString(previous) {
+			break
+		}
+		first--
+	}
+	text := ensureNewline(patch.Content)
+
+	switch patch.Operation {
+	case PatchPrepend:
+		return spliceLines(lines, first, first, text), nil
+	case PatchReplace:
+		// Keep the block reference so existing links stay valid, and the
+		// list marker and indentation so the list stays intact
+		replaced := strings.TrimRight(text, "\r\n")
+		if marker := listItemPattern.FindString(lines[first]); marker != "" {
+			indent := marker[:len(marker)-len(strings.TrimLeft(marker, " \t"))]
+			if listItemPattern.MatchString(replaced) {
+				marker = indent
+				replaced = strings.TrimLeft(replaced, " \t")
+			}
+			continuation := "\n" + strings.Repeat(" ", len(marker))
+			replaced = marker + strings.ReplaceAll(replaced, "\n", continuation)
+		}
+		replaced += " ^" + id + "\n"
+		return spliceLines(lines, first, last+1, replaced), nil
+	default:
+		return spliceLines(lines, last+1, last+1, text), nil
+	}
+}
+
+// patchFrontmatter edits a single frontmatter key with a JSON value
+func patchFrontmatter(content string, patch Patch) (string, error) {
+	fm, _, err := parseFrontmatter(content)
+	if err != nil {
+		return "", err
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(patch.Content), &value); err != nil {
+		return "", invalidPatch("frontmatter content must be a JSON value: %v", err)
+	}
+
+	key := strings.TrimSpace(patch.Target)
+	i := frontmatterIndex(fm, key)
+	if i < 0 {
+		if !patch.CreateTargetIfMissing {
+			return "", fmt.Errorf("frontmatter key %q %w", key, ErrNotFound)
+		}
+		return editFrontmatter(content, yaml.MapSlice{{Key: key, Value: value}}, nil)
+	}
+
+	switch patch.Operation {
+	case PatchAppend:
+		value = append(toList(fm[i].Value), toList(value)...)
+	case PatchPrepend:
+		value = append(toList(value), toList(fm[i].Value)...)
+	}
+	return editFrontmatter(content, yaml.MapSlice{{Key: key, Value: value}}, nil)
+}
+
+// toList returns value as a list, wrapping scalars
+func toList(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	default:
+		return []interface{}{v}
+	}
+}
@@ -0,0 +1,296 @@
+package api
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestApplyPatchHeading(t *testing.T) {
+	const note = "# A\nintro\n\n## B\nb text\n\n## C\nc text\n"
+
+	tests := []struct {
+		name    string
+		patch   Patch
+		content string
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "append",
+			content: note,
+			patch:   Patch{Operation: PatchAppend, TargetType: TargetHeading, Target: "A::B", Content: "more"},
+			want:    "# A\nintro\n\n## B\nb text\nmore\n\n## C\nc text\n",
+		},
+		{
+			name:    "prepend",
+			content: note,
+			patch:   Patch{Operation: PatchPrepend, TargetType: TargetHeading, Target: "A::C", Content: "first"},
+			want:    "# A\nintro\n\n## B\nb text\n\n## C\nfirst\nc text\n",
+		},
+		{
+			name:    "replace",
+			content: note,
+			patch:   Patch{Operation: PatchReplace, TargetType: TargetHeading, Target: "A::B", Content: "new\n\n"},
+			want:    "# A\nintro\n\n## B\nnew\n\n## C\nc text\n",
+		},
+		{
+			name:    "replace top level section",
+			content: "# A\na\n# Z\nz\n",
+			patch:   Patch{Operation: PatchReplace, TargetType: TargetHeading, Target: "A", Content: "x"},
+			want:    "# A\nx\n# Z\nz\n",
+		},
+		{
+			name:    "nested path must match parents",
+			content: note,
+			patch:   Patch{Operation: PatchAppend, TargetType: TargetHeading, Target: "B", Content: "x"},
+			wantErr: ErrNotFound,
+		},
+		{
+			name:    "headings in code fences ignored",
+			content: "```\n# A\n```\n# A\na\n",
+			patch:   Patch{Operation: PatchAppend, TargetType: TargetHeading, Target: "A", Content: "x"},
+			want:    "```\n# A\n```\n# A\na\nx\n",
+		},
+		{
+			name:    "frontmatter comments are not headings",
+			content: "---\n# A\ntitle: x\n---\n# A\na\n",
+			patch:   Patch{Operation: PatchAppend, TargetType: TargetHeading, Target: "A", Content: "x"},
+			want:    "---\n# A\ntitle: x\n---\n# A\na\nx\n",
+		},
+		{
+			name:    "frontmatter only",
+			content: "---\n# A\n---\n",
+			patch:   Patch{Operation: PatchAppend, TargetType: TargetHeading, Target: "A", Content: "x"},
+			wantErr: ErrNotFound,
+		},
+		{
+			name:    "create leaf below existing parent",
+			content: note,
+			patch:   Patch{Operation: PatchAppend, TargetType: TargetHeading, Target: "A::B::D", Content: "d", CreateTargetIfMissing: true},
+			want:    "# A\nintro\n\n## B\nb text\n\n### D\nd\n\n## C\nc text\n",
+		},
+		{
+			name:    "create missing parents",
+			content: note,
+			patch:   Patch{Operation: PatchAppend, TargetType: TargetHeading, Target: "X::Y", Content: "y", CreateTargetIfMissing: true},
+			want:    note + "\n# X\n## Y\ny\n",
+		},
+		{
+			name:    "create in empty note",
+			content: "",
+			patch:   Patch{Operation: PatchAppend, TargetType: TargetHeading, Target: "Tasks::Today", Content: "- a", CreateTargetIfMissing: true},
+			want:    "# Tasks\n## Today\n- a\n",
+		},
+		{
+			name:    "missing without create",
+			content: note,
+			patch:   Patch{Operation: PatchAppend, TargetType: TargetHeading, Target: "A::D", Content: "x"},
+			wantErr: ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyPatch(tt.content, tt.patch)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ApplyPatch() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ApplyPatch() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyPatchBlock(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		operation string
+		patchText string
+		want      string
+	}{
+		{
+			name:      "replace paragraph",
+			content:   "intro\n\nline one\nline two ^abc\n\nafter\n",
+			operation: PatchReplace, patchText: "X",
+			want: "intro\n\nX ^abc\n\nafter\n",
+		},
+		{
+			name:      "append paragraph",
+			content:   "line one ^abc\nnext\n",
+			operation: PatchAppend, patchText: "X",
+			want: "line one ^abc\nX\nnext\n",
+		},
+		{
+			name:      "prepend paragraph",
+			content:   "# H\nline one\nline two ^abc\n",
+			operation: PatchPrepend, patchText: "X",
+			want: "# H\nX\nline one\nline two ^abc\n",
+		},
+		{
+			name:      "replace dash item",
+			content:   "- item zero\n- item one ^abc\n- item two\n",
+			operation: PatchReplace, patchText: "X",
+			want: "- item zero\n- X ^abc\n- item two\n",
+		},
+		{
+			name:      "replace star item",
+			content:   "* item one ^abc\n",
+			operation: PatchReplace, patchText: "X",
+			want: "* X ^abc\n",
+		},
+		{
+			name:      "replace plus item",
+			content:   "+ item one ^abc\n",
+			operation: PatchReplace, patchText: "X",
+			want: "+ X ^abc\n",
+		},
+		{
+			name:      "replace numbered item",
+			content:   "1. first\n2. second ^abc\n",
+			operation: PatchReplace, patchText: "X",
+			want: "1. first\n2. X ^abc\n",
+		},
+		{
+			name:      "replace task",
+			content:   "- [ ] task ^abc\n- [x] done\n",
+			operation: PatchReplace, patchText: "X",
+			want: "- [ ] X ^abc\n- [x] done\n",
+		},
+		{
+			name:      "replace nested item",
+			content:   "- parent\n    - child ^abc\n",
+			operation: PatchReplace, patchText: "X",
+			want: "- parent\n    - X ^abc\n",
+		},
+		{
+			name:      "replace item with a list item",
+			content:   "- a\n  - old ^abc\n",
+			operation: PatchReplace, patchText: "* new",
+			want: "- a\n  * new ^abc\n",
+		},
+		{
+			name:      "replace item with continuation lines",
+			content:   "- a\n- b\n  more b ^abc\n- c\n",
+			operation: PatchReplace, patchText: "X\nY",
+			want: "- a\n- X\n  Y ^abc\n- c\n",
+		},
+		{
+			name:      "append item",
+			content:   "- a ^abc\n- b\n",
+			operation: PatchAppend, patchText: "- new",
+			want: "- a ^abc\n- new\n- b\n",
+		},
+		{
+			name:      "prepend item",
+			content:   "- a\n- b ^abc\n",
+			operation: PatchPrepend, patchText: "- new",
+			want: "- a\n- new\n- b ^abc\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch := Patch{Operation: tt.operation, TargetType: TargetBlock, Target: "^abc", Content: tt.patchText}
+			got, err := ApplyPatch(tt.content, patch)
+			if err != nil {
+				t.Fatalf("ApplyPatch() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ApplyPatch() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ApplyPatch("text ^other\n", Patch{Operation: PatchReplace, TargetType: TargetBlock, Target: "abc", Content: "x"}); err == nil {
+		t.Error("ApplyPatch() on a missing block succeeded, want an error")
+	}
+}
+
+func TestApplyPatchFrontmatter(t *testing.T) {
+	const note = "---\ntitle: Plan\ntags:\n- a\n---\nbody\n"
+
+	tests := []struct {
+		name    string
+		content string
+		patch   Patch
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "replace",
+			content: note,
+			patch:   Patch{Operation: PatchReplace, TargetType: TargetFrontmatter, Target: "title", Content: `"Roadmap"`},
+			want:    "---\ntitle: Roadmap\ntags:\n- a\n---\nbody\n",
+		},
+		{
+			name:    "append to list",
+			content: note,
+			patch:   Patch{Operation: PatchAppend, TargetType: TargetFrontmatter, Target: "tags", Content: `"b"`},
+			want:    "---\ntitle: Plan\ntags:\n- a\n- b\n---\nbody\n",
+		},
+		{
+			name:    "prepend to list",
+			content: note,
+			patch:   Patch{Operation: PatchPrepend, TargetType: TargetFrontmatter, Target: "tags", Content: `["b", "c"]`},
+			want:    "---\ntitle: Plan\ntags:\n- b\n- c\n- a\n---\nbody\n",
+		},
+		{
+			name:    "create key",
+			content: note,
+			patch:   Patch{Operation: PatchReplace, TargetType: TargetFrontmatter, Target: "status", Content: `"done"`, CreateTargetIfMissing: true},
+			want:    "---\ntitle: Plan\ntags:\n- a\nstatus: done\n---\nbody\n",
+		},
+		{
+			name:    "create frontmatter",
+			content: "body\n",
+			patch:   Patch{Operation: PatchReplace, TargetType: TargetFrontmatter, Target: "status", Content: `"done"`, CreateTargetIfMissing: true},
+			want:    "---\nstatus: done\n---\nbody\n",
+		},
+		{
+			name:    "missing key",
+			content: note,
+			patch:   Patch{Operation: PatchReplace, TargetType: TargetFrontmatter, Target: "status", Content: `"done"`},
+			wantErr: ErrNotFound,
+		},
+		{
+			name:    "invalid JSON",
+			content: note,
+			patch:   Patch{Operation: PatchReplace, TargetType: TargetFrontmatter, Target: "title", Content: `Roadmap`},
+			wantErr: ErrInvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyPatch(tt.content, tt.patch)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ApplyPatch() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ApplyPatch() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   Patch
+		wantErr error
+	}{
+		{"unknown operation", Patch{Operation: "insert", TargetType: TargetHeading, Target: "A"}, ErrInvalidArgument},
+		{"unknown target type", Patch{Operation: PatchAppend, TargetType: "line", Target: "A"}, ErrInvalidArgument},
+		{"no target", Patch{Operation: PatchAppend, TargetType: TargetHeading, Target: " "}, ErrInvalidArgument},
+		{"frontmatter not JSON", Patch{Operation: PatchAppend, TargetType: TargetFrontmatter, Target: "tags", Content: "a"}, ErrInvalidArgument},
+		{"missing block", Patch{Operation: PatchAppend, TargetType: TargetBlock, Target: "^nope", Content: "x"}, ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		if _, err := ApplyPatch("# A\ntext ^abc\n", tt.patch); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: ApplyPatch() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
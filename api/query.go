@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"obsidian-mcp/search"
+)
+
+// Querier is implemented by backends that can evaluate a structured search
+// query without reading every note
+type Querier interface {
+	QueryNotes(ctx context.Context, query *search.Query, opts SearchOptions) ([]SearchResult, error)
+}
+
+// QueryNotes returns the notes matching a structured search query, with
+// the context of each word, phrase and pattern it found. Backends that are
+// not Queriers have every note read, or only listed for queries on paths
+// and modification times.
+func QueryNotes(ctx context.Context, vault VaultBackend, query *search.Query, opts SearchOptions) ([]SearchResult, error) {
+	if querier, ok := vault.(Querier); ok {
+		return querier.QueryNotes(ctx, query, opts)
+	}
+	return scanNotes(ctx, vault, query, nil, opts)
+}
+
+// scanNotes matches a query against the given notes, or every note when
+// notes is nil. When every note is read, results are ranked with BM25 over
+// the vault by the query's words, as an index would rank them; otherwise,
+// or for queries without words, by their number of matches.
+func scanNotes(ctx context.Context, vault VaultBackend, query *search.Query, notes []string, opts SearchOptions) ([]SearchResult, error) {
+	var ranking *search.Index
+	terms := query.Terms()
+	var times map[string]int64
+	if query.NeedsModTime() {
+		lister, ok := vault.(ModTimeLister)
+		if !ok {
+			return nil, fmt.Errorf("backend cannot report modification times")
+		}
+		var err error
+		if times, err = lister.NoteModTimes(ctx); err != nil {
+			return nil, fmt.Errorf("failed to get modification times: %w", err)
+		}
+	}
+	if notes == nil {
+		if len(terms) > 0 {
+			ranking = search.NewIndex()
+		}
+		if times != nil {
+			notes = make([]string, 0, len(times))
+			for note := range times {
+				notes = append(notes, note)
+			}
+		} else {
+			var err error
+			if notes, err = vault.ListAllNotes(ctx); err != nil {
+				return nil, err
+			}
+		}
+		sort.Strings(notes)
+	}
+
+	results := []SearchResult{}
+	for _, note := range notes {
+		if err := contextError(ctx); err != nil {
+			return nil, err
+		}
+		if !opts.included(note) {
+			continue
+		}
+		doc := &search.Document{Path: note}
+		if times != nil {
+			mtime, ok := times[note]
+			if !ok {
+				// Deleted since the vault was listed
+				continue
+			}
+			if mtime != 0 {
+				doc.ModTime = time.UnixMilli(mtime)
+			}
+		}
+		if query.NeedsContent() {
+			content, err := vault.GetNote(ctx, note)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", note, err)
+			}
+			doc.Content = content
+			// Notes with broken frontmatter are searched without properties
+			doc.Properties, _, _ = ReadFrontmatter(content)
+			if ranking != nil {
+				ranking.Add(note, content, 0)
+			}
+		}
+		if !query.Match(doc) {
+			continue
+		}
+
+		spans := query.Highlights(doc.Content)
+		results = append(results, SearchResult{Path: note, Score: float64(len(spans)), Matches: spanMatches(doc.Content, spans, opts)})
+	}
+
+	if ranking != nil {
+		scores := make(map[string]float64)
+		for _, hit := range ranking.Search(terms) {
+			scores[hit.Path] = hit.Score
+		}
+		for i := range results {
+			results[i].Score = scores[results[i].Path]
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	return results, nil
+}
+
+// spanMatches returns the first matches of a query in content, with their
+// context
+func spanMatches(content string, spans []search.Span, opts SearchOptions) []SearchMatch {
+	matches := []SearchMatch{}
+	for _, span := range spans[:min(len(spans), opts.MaxMatches)] {
+		matches = append(matches, opts.match(content, span.Start, span.End))
+	}
+	return matches
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"obsidian-mcp/search"
+)
+
+func TestQueryNotesBackendsAgree(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"both.md":      "Garden roses in spring",
+		"twice.md":     "garden garden and roses, a longer note about the garden and its roses",
+		"garden.md":    "Only the garden",
+		"roses.md":     "Only roses",
+		"unrelated.md": "Kitchen recipes",
+	} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs, err := NewFileSystemVault(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	indexed := NewIndexedVault(fs, "test", "")
+	go indexed.Build(ctx)
+	for !indexed.ready.Load() {
+		time.Sleep(time.Millisecond)
+	}
+
+	opts := SearchOptions{ContextLength: 10, MaxMatches: 3, Limit: 10}
+	for _, text := range []string{"garden roses", "gardens", "garden OR roses", "roses -spring"} {
+		query, err := search.ParseQuery(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanned, err := QueryNotes(ctx, fs, query, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fromIndex, err := QueryNotes(ctx, indexed, query, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(scanned) != len(fromIndex) {
+			t.Errorf("%q: filesystem found %d notes, index %d", text, len(scanned), len(fromIndex))
+			continue
+		}
+		for i := range scanned {
+			s, x := scanned[i], fromIndex[i]
+			if s.Path != x.Path || math.Abs(s.Score-x.Score) > 1e-9 || len(s.Matches) != len(x.Matches) {
+				t.Errorf("%q result %d: filesystem %s (%g, %d matches), index %s (%g, %d matches)",
+					text, i, s.Path, s.Score, len(s.Matches), x.Path, x.Score, len(x.Matches))
+			}
+		}
+	}
+
+	// Words next to each other must all match
+	query, _ := search.ParseQuery("garden roses")
+	results, _ := QueryNotes(ctx, fs, query, opts)
+	if len(results) != 2 {
+		t.Errorf("garden roses = %+v, want both.md and twice.md", results)
+	}
+}
+
+func TestIndexedVaultSeesChangesBehindIt(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		file := filepath.Join(root, name)
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		// Make sure the modification time differs from the indexed one
+		later := time.Now().Add(time.Hour)
+		if err := os.Chtimes(file, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("kept.md", "Garden roses")
+	write("gone.md", "Garden tulips")
+	fs, err := NewFileSystemVault(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	indexed := NewIndexedVault(fs, "test", "")
+	go indexed.Build(ctx)
+	for !indexed.ready.Load() {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Nothing watches the vault, so the index learns about these from the
+	// next search
+	write("kept.md", "Kitchen herbs")
+	write("new.md", "Garden herbs")
+	if err := os.Remove(filepath.Join(root, "gone.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := SearchOptions{ContextLength: 10, MaxMatches: 3, Limit: 10}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"garden", []string{"new.md"}},
+		{"herbs", []string{"kept.md", "new.md"}},
+		{"roses OR tulips", nil},
+	}
+	for _, tt := range tests {
+		query, err := search.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := QueryNotes(ctx, indexed, query, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, result := range results {
+			got = append(got, result.Path)
+		}
+		sort.Strings(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("QueryNotes(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
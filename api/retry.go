@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// idempotent reports whether a request with method can be retried safely
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// backoff returns the delay before retry number attempt (starting at 0):
+// base doubled per attempt up to max, with up to half of it as jitter so
+// clients don't retry in lockstep
+func backoff(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 0; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if max > 0 && delay > max {
+		delay = max
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return contextError(ctx)
+	}
+}
+
+// breaker is a circuit breaker for requests to Obsidian. After threshold
+// consecutive failures it fails fast for cooldown, then lets a single probe
+// request through; the probe's outcome closes or reopens the breaker.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// newBreaker creates a circuit breaker, or nil when threshold disables it
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &breaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// allow returns ErrUnavailable while the breaker is open
+func (b *breaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+	if wait := b.openUntil.Sub(b.now()); wait > 0 {
+		return fmt.Errorf("%w: %d requests in a row failed, trying again in %s",
+			ErrUnavailable, b.failures, (wait + time.Second - 1).Truncate(time.Second))
+	}
+	if b.probing {
+		return fmt.Errorf("%w: %d requests in a row failed, checking whether it is back", ErrUnavailable, b.failures)
+	}
+	b.probing = true
+	return nil
+}
+
+// succeeded closes the breaker
+func (b *breaker) succeeded() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.probing = false
+}
+
+// failed counts a failure and opens the breaker once the threshold is reached
+func (b *breaker) failed() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.cooldown)
+	}
+}
+
+// abandoned records a request that ended without an answer, for example
+// because it was cancelled, so another probe may be sent
+func (b *breaker) abandoned() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
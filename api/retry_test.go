@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt   int
+		base, max time.Duration
+		want      time.Duration // before jitter
+	}{
+		{0, 100 * time.Millisecond, time.Second, 100 * time.Millisecond},
+		{1, 100 * time.Millisecond, time.Second, 200 * time.Millisecond},
+		{3, 100 * time.Millisecond, time.Second, 800 * time.Millisecond},
+		{4, 100 * time.Millisecond, time.Second, time.Second},
+		{60, 100 * time.Millisecond, time.Second, time.Second},
+		{2, 0, time.Second, 0},
+	}
+
+	for _, tt := range tests {
+		for range 20 {
+			got := backoff(tt.attempt, tt.base, tt.max)
+			if got < tt.want/2 || got > tt.want {
+				t.Errorf("backoff(%d, %s, %s) = %s, want between %s and %s", tt.attempt, tt.base, tt.max, got, tt.want/2, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// roundTripFunc answers requests without a server
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func statusResponse(code int) *http.Response {
+	return &http.Response{StatusCode: code, Body: io.NopCloser(strings.NewReader(http.StatusText(code)))}
+}
+
+func TestMakeContentRequestRetries(t *testing.T) {
+	refused := errors.New("connection refused")
+
+	tests := []struct {
+		name       string
+		method     string
+		answer     func(ctx context.Context, cancel func()) (*http.Response, error)
+		wantCalls  int
+		wantStatus int
+		wantErr    error
+	}{
+		{"5xx", http.MethodGet, func(context.Context, func()) (*http.Response, error) {
+			return statusResponse(http.StatusBadGateway), nil
+		}, 3, http.StatusBadGateway, nil},
+		{"network error", http.MethodPut, func(context.Context, func()) (*http.Response, error) {
+			return nil, refused
+		}, 3, 0, ErrUnavailable},
+		{"not idempotent", http.MethodPost, func(context.Context, func()) (*http.Response, error) {
+			return statusResponse(http.StatusServiceUnavailable), nil
+		}, 1, http.StatusServiceUnavailable, nil},
+		{"4xx", http.MethodGet, func(context.Context, func()) (*http.Response, error) {
+			return statusResponse(http.StatusNotFound), nil
+		}, 1, http.StatusNotFound, nil},
+		{"cancelled", http.MethodGet, func(ctx context.Context, cancel func()) (*http.Response, error) {
+			cancel()
+			return nil, ctx.Err()
+		}, 1, 0, ErrCanceled},
+	}
+
+	for _, tt := range tests {
+		api, err := NewObsidianAPI("http://obsidian.test", "token", ClientOptions{MaxRetries: 2, RetryBaseDelay: time.Millisecond, RetryMaxDelay: time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		calls := 0
+		api.client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			calls++
+			return tt.answer(ctx, cancel)
+		})
+
+		resp, err := api.makeContentRequest(ctx, tt.method, "/vault/a.md", "", "", nil)
+		cancel()
+		if calls != tt.wantCalls {
+			t.Errorf("%s: %d requests sent, want %d", tt.name, calls, tt.wantCalls)
+		}
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: error %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || resp.StatusCode != tt.wantStatus {
+			t.Errorf("%s: response %v, %v, want status %d", tt.name, resp, err, tt.wantStatus)
+			continue
+		}
+		resp.Body.Close()
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newBreaker(2, 10*time.Second)
+	b.now = func() time.Time { return now }
+
+	steps := []struct {
+		name    string
+		do      func()
+		advance time.Duration
+		wantErr bool
+	}{
+		{"closed", nil, 0, false},
+		{"one failure", b.failed, 0, false},
+		{"threshold reached", b.failed, 0, true},
+		{"still cooling down", nil, 9 * time.Second, true},
+		// allow lets one probe through and holds back the rest
+		{"probe", nil, time.Second, false},
+		{"during probe", nil, 0, true},
+		{"probe abandoned", b.abandoned, 0, false},
+		{"probe failed", b.failed, 0, true},
+		{"cooled down again", nil, 10 * time.Second, false},
+		{"probe succeeded", b.succeeded, 0, false},
+		{"closed again", nil, 0, false},
+	}
+
+	for _, step := range steps {
+		if step.do != nil {
+			step.do()
+		}
+		now = now.Add(step.advance)
+		err := b.allow()
+		if (err != nil) != step.wantErr {
+			t.Fatalf("%s: allow() = %v, want an error: %t", step.name, err, step.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrUnavailable) {
+			t.Errorf("%s: allow() = %v, want ErrUnavailable", step.name, err)
+		}
+	}
+
+	var disabled *breaker
+	if newBreaker(0, time.Second) != nil || disabled.allow() != nil {
+		t.Error("a breaker with threshold 0 should be disabled")
+	}
+}
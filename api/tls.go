@@ -0,0 +1,86 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// tlsConfig builds the TLS configuration for connecting to the Local REST
+// API's HTTPS port, or nil when the defaults apply
+func tlsConfig(opts ClientOptions) (*tls.Config, error) {
+	if opts.CACertFile == "" && opts.CertFingerprint == "" && !opts.InsecureSkipVerify {
+		return nil, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if opts.CACertFile != "" {
+		data, err := os.ReadFile(opts.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no PEM certificates found in %s", opts.CACertFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if opts.CertFingerprint != "" {
+		pinned, err := parseFingerprint(opts.CertFingerprint)
+		if err != nil {
+			return nil, err
+		}
+		// The pin takes the place of chain verification for the plugin's
+		// self-signed certificate unless a CA bundle is given as well
+		if opts.CACertFile == "" {
+			config.InsecureSkipVerify = true
+		}
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("server presented no certificate")
+			}
+			sum := sha256.Sum256(state.PeerCertificates[0].Raw)
+			if hex.EncodeToString(sum[:]) != pinned {
+				return &tls.CertificateVerificationError{
+					UnverifiedCertificates: state.PeerCertificates,
+					Err:                    fmt.Errorf("fingerprint %s does not match the pinned fingerprint", formatFingerprint(sum[:])),
+				}
+			}
+			return nil
+		}
+	}
+
+	if opts.InsecureSkipVerify {
+		config.InsecureSkipVerify = true
+	}
+
+	return config, nil
+}
+
+// parseFingerprint normalizes a SHA-256 fingerprint written as hex, with or
+// without colons, such as openssl's "AB:CD:..." output
+func parseFingerprint(fingerprint string) (string, error) {
+	normalized := strings.ToLower(strings.NewReplacer(":", "", " ", "").Replace(fingerprint))
+	normalized = strings.TrimPrefix(normalized, "sha256/")
+	decoded, err := hex.DecodeString(normalized)
+	if err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("invalid certificate fingerprint %q: expected a SHA-256 hash in hex", fingerprint)
+	}
+	return normalized, nil
+}
+
+// formatFingerprint formats a fingerprint like openssl does
+func formatFingerprint(sum []byte) string {
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
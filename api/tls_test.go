@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCertificatePinning(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("note"))
+	}))
+	// Rejected handshakes are expected
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	sum := sha256.Sum256(server.Certificate().Raw)
+	other := sha256.Sum256([]byte("another certificate"))
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    ClientOptions
+		wantErr error
+	}{
+		{"pin in hex", ClientOptions{CertFingerprint: hex.EncodeToString(sum[:])}, nil},
+		{"pin as printed by openssl", ClientOptions{CertFingerprint: formatFingerprint(sum[:])}, nil},
+		{"pin with CA bundle", ClientOptions{CertFingerprint: formatFingerprint(sum[:]), CACertFile: caFile}, nil},
+		{"CA bundle", ClientOptions{CACertFile: caFile}, nil},
+		{"mismatched pin", ClientOptions{CertFingerprint: hex.EncodeToString(other[:])}, ErrCertificate},
+		{"mismatched pin with CA bundle", ClientOptions{CertFingerprint: hex.EncodeToString(other[:]), CACertFile: caFile}, ErrCertificate},
+		{"system roots", ClientOptions{}, ErrCertificate},
+	}
+
+	for _, tt := range tests {
+		tt.opts.MaxRetries = 2
+		api, err := NewObsidianAPI(server.URL, "token", tt.opts)
+		if err != nil {
+			t.Errorf("%s: NewObsidianAPI() error = %v", tt.name, err)
+			continue
+		}
+		content, err := api.GetNote(context.Background(), "a.md")
+		if tt.wantErr == nil {
+			if err != nil || content != "note" {
+				t.Errorf("%s: GetNote() = %q, %v, want the note", tt.name, content, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: GetNote() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseFingerprint(t *testing.T) {
+	sum := sha256.Sum256([]byte("certificate"))
+	want := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		input   string
+		wantErr bool
+	}{
+		{want, false},
+		{strings.ToUpper(want), false},
+		{formatFingerprint(sum[:]), false},
+		{"sha256/" + want, false},
+		{"", true},
+		{"not hex", true},
+		{want[:62], true},
+		{want + "00", true},
+		{strings.Replace(want, want[:1], "g", 1), true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseFingerprint(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseFingerprint(%q) error = %v, want an error: %t", tt.input, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != want {
+			t.Errorf("parseFingerprint(%q) = %q, want %q", tt.input, got, want)
+		}
+	}
+
+	if _, err := NewObsidianAPI("https://127.0.0.1:27124", "token", ClientOptions{CertFingerprint: "AB:CD"}); err == nil {
+		t.Error("NewObsidianAPI() accepted a malformed fingerprint")
+	}
+}
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTrashFolder is the folder deleted notes are moved to, the same
+// folder Obsidian uses for its own trash
+const DefaultTrashFolder = ".trash"
+
+// trashIndexName names the file in the trash folder that records where
+// each trashed note came from and when it was deleted
+const trashIndexName = ".trash-index.json"
+
+// TrashEntry is a note in the trash folder
+type TrashEntry struct {
+	Path         string `json:"path"`                    // path of the note in the trash folder
+	OriginalPath string `json:"original_path,omitempty"` // empty for notes trashed outside this server
+	DeletedAt    string `json:"deleted_at,omitempty"`    // RFC 3339, UTC
+}
+
+// trashMu serializes changes to trash indexes
+var trashMu sync.Mutex
+
+// TrashNote moves a note into the trash folder instead of deleting it and
+// records its original path and the deletion time. A note whose name is
+// already taken in the trash gets a number appended, as in Obsidian.
+func TrashNote(ctx context.Context, vault VaultBackend, folder, notePath string) (TrashEntry, error) {
+	notePath = NormalizeNotePath(notePath)
+	if inFolder(notePath, folder) {
+		return TrashEntry{}, fmt.Errorf("%s is already in the trash; use empty_trash to delete it permanently", notePath)
+	}
+
+	trashMu.Lock()
+	defer trashMu.Unlock()
+
+	exists, err := NoteExists(ctx, vault, notePath)
+	if err != nil {
+		return TrashEntry{}, err
+	}
+	if !exists {
+		return TrashEntry{}, fmt.Errorf("%s %w", notePath, ErrNotFound)
+	}
+
+	entries, err := readTrashIndex(ctx, vault, folder)
+	if err != nil {
+		return TrashEntry{}, err
+	}
+	target, err := freeTrashPath(ctx, vault, folder, notePath, entries)
+	if err != nil {
+		return TrashEntry{}, err
+	}
+
+	if _, err := vault.MoveNote(ctx, notePath, target); err != nil {
+		return TrashEntry{}, err
+	}
+
+	entry := TrashEntry{Path: target, OriginalPath: notePath, DeletedAt: time.Now().UTC().Format(time.RFC3339)}
+	entries[target] = entry
+	if err := writeTrashIndex(ctx, vault, folder, entries); err != nil {
+		return entry, fmt.Errorf("moved %s to %s but failed to record where it came from: %w", notePath, target, err)
+	}
+	return entry, nil
+}
+
+// ListTrash lists the notes in the trash folder, most recently deleted
+// first. Notes trashed outside this server are listed without an origin.
+func ListTrash(ctx context.Context, vault VaultBackend, folder string) ([]TrashEntry, error) {
+	entries, err := readTrashIndex(ctx, vault, folder)
+	if err != nil {
+		return nil, err
+	}
+	names, err := vault.ListNotes(ctx, folder)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		notePath := path.Join(folder, name)
+		if _, ok := entries[notePath]; !ok {
+			entries[notePath] = TrashEntry{Path: notePath}
+		}
+	}
+
+	list := make([]TrashEntry, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].DeletedAt != list[j].DeletedAt {
+			return list[i].DeletedAt > list[j].DeletedAt
+		}
+		return list[i].Path < list[j].Path
+	})
+	return list, nil
+}
+
+// RestoreNote moves a note out of the trash folder, to its original path
+// unless to is given, and returns the path it was restored to
+func RestoreNote(ctx context.Context, vault VaultBackend, folder, trashPath, to string) (string, error) {
+	trashPath = NormalizeNotePath(trashPath)
+	if !inFolder(trashPath, folder) {
+		return "", fmt.Errorf("%s is not in the trash folder %s", trashPath, folder)
+	}
+
+	trashMu.Lock()
+	defer trashMu.Unlock()
+
+	entries, err := readTrashIndex(ctx, vault, folder)
+	if err != nil {
+		return "", err
+	}
+	if to == "" {
+		to = entries[trashPath].OriginalPath
+		if to == "" {
+			return "", fmt.Errorf("the original path of %s is unknown; pass the path to restore it to", trashPath)
+		}
+	}
+	to = NormalizeNotePath(to)
+	if inFolder(to, folder) {
+		return "", fmt.Errorf("cannot restore %s into the trash folder", trashPath)
+	}
+
+	exists, err := NoteExists(ctx, vault, to)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return "", fmt.Errorf("%s %w", to, ErrAlreadyExists)
+	}
+
+	if _, err := vault.MoveNote(ctx, trashPath, to); err != nil {
+		return "", err
+	}
+
+	if _, ok := entries[trashPath]; ok {
+		delete(entries, trashPath)
+		if err := writeTrashIndex(ctx, vault, folder, entries); err != nil {
+			return to, fmt.Errorf("restored %s to %s but failed to update the trash index: %w", trashPath, to, err)
+		}
+	}
+	return to, nil
+}
+
+// EmptyTrash permanently deletes every note in the trash folder and
+// returns the entries of the notes it deleted
+func EmptyTrash(ctx context.Context, vault VaultBackend, folder string) ([]TrashEntry, error) {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+
+	list, err := ListTrash(ctx, vault, folder)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := []TrashEntry{}
+	for _, entry := range list {
+		if _, err := vault.DeleteNote(ctx, entry.Path); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return deleted, err
+		}
+		deleted = append(deleted, entry)
+	}
+	if err := writeTrashIndex(ctx, vault, folder, nil); err != nil {
+		return deleted, err
+	}
+	return deleted, nil
+}
+
+// TrashOrigin returns where a note in the trash folder was deleted from,
+// or "" if it was trashed outside this server
+func TrashOrigin(ctx context.Context, vault VaultBackend, folder, trashPath string) (string, error) {
+	entries, err := readTrashIndex(ctx, vault, folder)
+	if err != nil {
+		return "", err
+	}
+	return entries[NormalizeNotePath(trashPath)].OriginalPath, nil
+}
+
+// InTrash reports whether a note path lies in the trash folder
+func InTrash(notePath, folder string) bool {
+	return inFolder(NormalizeNotePath(notePath), folder)
+}
+
+// inFolder reports whether a note path lies inside folder
+func inFolder(notePath, folder string) bool {
+	return strings.HasPrefix(notePath, strings.TrimSuffix(folder, "/")+"/")
+}
+
+// freeTrashPath returns the path in the trash folder for a note, numbered
+// when its name is taken
+func freeTrashPath(ctx context.Context, vault VaultBackend, folder, notePath string, entries map[string]TrashEntry) (string, error) {
+	ext := path.Ext(notePath)
+	name := strings.TrimSuffix(path.Base(notePath), ext)
+
+	candidate := path.Join(folder, name+ext)
+	for n := 2; ; n++ {
+		if _, tracked := entries[candidate]; !tracked {
+			exists, err := NoteExists(ctx, vault, candidate)
+			if err != nil {
+				return "", err
+			}
+			if !exists {
+				return candidate, nil
+			}
+		}
+		candidate = path.Join(folder, fmt.Sprintf("%s %d%s", name, n, ext))
+	}
+}
+
+// readTrashIndex reads the trash index of a vault, keyed by trash path
+func readTrashIndex(ctx context.Context, vault VaultBackend, folder string) (map[string]TrashEntry, error) {
+	entries := make(map[string]TrashEntry)
+	content, err := vault.GetNote(ctx, path.Join(folder, trashIndexName))
+	if errors.Is(err, ErrNotFound) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trash index: %w", err)
+	}
+
+	var list []TrashEntry
+	if err := json.Unmarshal([]byte(content), &list); err != nil {
+		return nil, fmt.Errorf("invalid trash index: %v", err)
+	}
+	for _, entry := range list {
+		entries[entry.Path] = entry
+	}
+	return entries, nil
+}
+
+// writeTrashIndex saves the trash index of a vault, removing it once the
+// trash is empty
+func writeTrashIndex(ctx context.Context, vault VaultBackend, folder string, entries map[string]TrashEntry) error {
+	indexPath := path.Join(folder, trashIndexName)
+	if len(entries) == 0 {
+		if _, err := vault.DeleteNote(ctx, indexPath); err != nil && !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("failed to remove trash index: %w", err)
+		}
+		return nil
+	}
+
+	list := make([]TrashEntry, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode trash index: %v", err)
+	}
+	if _, err := vault.UpdateNote(ctx, indexPath, string(data)+"\n"); err != nil {
+		return fmt.Errorf("failed to write trash index: %w", err)
+	}
+	return nil
+}
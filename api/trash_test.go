@@ -0,0 +1,208 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newTrashTestVault(t *testing.T, files map[string]string) (*FileSystemVault, string) {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vault, err := NewFileSystemVault(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vault, root
+}
+
+func TestTrashNoteCollisions(t *testing.T) {
+	vault, root := newTrashTestVault(t, map[string]string{
+		"a.md":          "first",
+		"Folder/a.md":   "second",
+		"b.md":          "mine",
+		".trash/b.md":   "trashed in Obsidian",
+		".trash/c 2.md": "taken",
+	})
+	ctx := context.Background()
+
+	tests := []struct {
+		note string
+		want string
+	}{
+		{"a.md", ".trash/a.md"},
+		{"Folder/a.md", ".trash/a 2.md"},
+		// Files trashed outside the server take their names too
+		{"b.md", ".trash/b 2.md"},
+	}
+	for _, tt := range tests {
+		entry, err := TrashNote(ctx, vault, DefaultTrashFolder, tt.note)
+		if err != nil {
+			t.Fatalf("TrashNote(%q): %v", tt.note, err)
+		}
+		if entry.Path != tt.want || entry.OriginalPath != tt.note || entry.DeletedAt == "" {
+			t.Errorf("TrashNote(%q) = %+v, want it at %s", tt.note, entry, tt.want)
+		}
+	}
+	if content, _ := vault.GetNote(ctx, ".trash/b.md"); content != "trashed in Obsidian" {
+		t.Errorf(".trash/b.md = %q, want it untouched", content)
+	}
+	if _, err := TrashNote(ctx, vault, DefaultTrashFolder, ".trash/a.md"); err == nil {
+		t.Error("TrashNote() of a note in the trash succeeded")
+	}
+	if _, err := TrashNote(ctx, vault, DefaultTrashFolder, "missing.md"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("TrashNote(missing.md) error = %v, want ErrNotFound", err)
+	}
+
+	entries, err := ListTrash(ctx, vault, DefaultTrashFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	origins := make(map[string]string)
+	for _, entry := range entries {
+		origins[entry.Path] = entry.OriginalPath
+	}
+	want := map[string]string{
+		".trash/a.md":   "a.md",
+		".trash/a 2.md": "Folder/a.md",
+		".trash/b 2.md": "b.md",
+		".trash/b.md":   "",
+		".trash/c 2.md": "",
+	}
+	if !reflect.DeepEqual(origins, want) {
+		t.Errorf("ListTrash() = %v, want %v", origins, want)
+	}
+	// Untracked notes have no deletion time and come last
+	if last := entries[len(entries)-1]; last.DeletedAt != "" {
+		t.Errorf("ListTrash() ends with %+v, want an untracked note", last)
+	}
+	if _, err := os.Stat(filepath.Join(root, ".trash", trashIndexName)); err != nil {
+		t.Errorf("trash index not written: %v", err)
+	}
+}
+
+func TestRestoreNote(t *testing.T) {
+	vault, _ := newTrashTestVault(t, map[string]string{
+		"a.md":        "trashed",
+		"b.md":        "trashed too",
+		".trash/x.md": "trashed in Obsidian",
+	})
+	ctx := context.Background()
+	for _, note := range []string{"a.md", "b.md"} {
+		if _, err := TrashNote(ctx, vault, DefaultTrashFolder, note); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := vault.CreateNote(ctx, "a.md", "new note"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		trashPath string
+		to        string
+		want      string
+		wantErr   error
+	}{
+		{"over an existing note", ".trash/a.md", "", "", ErrAlreadyExists},
+		{"unknown origin", ".trash/x.md", "", "", nil},
+		{"outside the trash", "a.md", "", "", nil},
+		{"into the trash", ".trash/a.md", ".trash/y.md", "", nil},
+		{"elsewhere", ".trash/a.md", "Restored/a.md", "Restored/a.md", nil},
+		{"to its origin", ".trash/b.md", "", "b.md", nil},
+		{"given a path", ".trash/x.md", "x.md", "x.md", nil},
+	}
+	for _, tt := range tests {
+		got, err := RestoreNote(ctx, vault, DefaultTrashFolder, tt.trashPath, tt.to)
+		if tt.want == "" {
+			if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+				t.Errorf("%s: RestoreNote() = %q, %v, want an error", tt.name, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: RestoreNote() = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	if content, _ := vault.GetNote(ctx, "a.md"); content != "new note" {
+		t.Errorf("a.md = %q, want the existing note kept", content)
+	}
+	if entries, err := ListTrash(ctx, vault, DefaultTrashFolder); err != nil || len(entries) != 0 {
+		t.Errorf("ListTrash() = %+v, %v, want the trash empty", entries, err)
+	}
+}
+
+func TestTrashIndexMissingOrCorrupt(t *testing.T) {
+	ctx := context.Background()
+
+	// Without an index, notes are listed without their origin
+	vault, _ := newTrashTestVault(t, map[string]string{".trash/a.md": "x"})
+	entries, err := ListTrash(ctx, vault, DefaultTrashFolder)
+	if want := []TrashEntry{{Path: ".trash/a.md"}}; err != nil || !reflect.DeepEqual(entries, want) {
+		t.Errorf("ListTrash() without index = %+v, %v, want %+v", entries, err, want)
+	}
+	if entries, err := ListTrash(ctx, vault, "Empty"); err != nil || len(entries) != 0 {
+		t.Errorf("ListTrash() of a missing folder = %+v, %v, want nothing", entries, err)
+	}
+
+	vault, _ = newTrashTestVault(t, map[string]string{
+		"b.md":                     "x",
+		".trash/a.md":              "x",
+		".trash/" + trashIndexName: "{not json",
+	})
+	if _, err := ListTrash(ctx, vault, DefaultTrashFolder); err == nil {
+		t.Error("ListTrash() with a corrupt index succeeded")
+	}
+	if _, err := TrashNote(ctx, vault, DefaultTrashFolder, "b.md"); err == nil {
+		t.Error("TrashNote() with a corrupt index succeeded")
+	}
+	if _, err := RestoreNote(ctx, vault, DefaultTrashFolder, ".trash/a.md", "a.md"); err == nil {
+		t.Error("RestoreNote() with a corrupt index succeeded")
+	}
+	if exists, _ := NoteExists(ctx, vault, "b.md"); !exists {
+		t.Error("TrashNote() moved b.md although it couldn't record it")
+	}
+}
+
+func TestEmptyTrash(t *testing.T) {
+	vault, root := newTrashTestVault(t, map[string]string{
+		"a.md":        "x",
+		".trash/b.md": "trashed in Obsidian",
+	})
+	ctx := context.Background()
+	if _, err := TrashNote(ctx, vault, DefaultTrashFolder, "a.md"); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := EmptyTrash(ctx, vault, DefaultTrashFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range deleted {
+		got = append(got, entry.Path+" from "+entry.OriginalPath)
+	}
+	if want := []string{".trash/a.md from a.md", ".trash/b.md from "}; !reflect.DeepEqual(got, want) {
+		t.Errorf("EmptyTrash() = %v, want %v", got, want)
+	}
+	files, err := os.ReadDir(filepath.Join(root, ".trash"))
+	if err != nil || len(files) != 0 {
+		t.Errorf("trash folder holds %v, %v, want nothing", files, err)
+	}
+
+	if deleted, err := EmptyTrash(ctx, vault, DefaultTrashFolder); err != nil || len(deleted) != 0 {
+		t.Errorf("EmptyTrash() of an empty trash = %+v, %v", deleted, err)
+	}
+}
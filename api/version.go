@@ -0,0 +1,28 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// NoteVersion returns the version of a note's content, its SHA-256 hash in
+// hex. Any edit, in Obsidian or through a tool, changes the version.
+func NoteVersion(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckVersion returns an ErrConflict error carrying the current content
+// when a note is not at the expected version. An empty expected version
+// always matches.
+func CheckVersion(path, expected, content string) error {
+	if expected == "" {
+		return nil
+	}
+	if current := NoteVersion(content); current != expected {
+		return fmt.Errorf("%w: %s has changed (expected version %s, current version %s)\n\nCurrent content:\n%s",
+			ErrConflict, NormalizeNotePath(path), expected, current, content)
+	}
+	return nil
+}
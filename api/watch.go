@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"time"
+)
+
+// Kinds of note changes reported by a Watcher
+const (
+	NoteCreated  = "created"
+	NoteModified = "modified"
+	NoteDeleted  = "deleted"
+)
+
+// NoteChange is a change to a single note
+type NoteChange struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+}
+
+// WatchOptions configures change detection
+type WatchOptions struct {
+	// PollInterval is how often backends without change events poll the
+	// vault. Such backends don't watch at all when it is zero.
+	PollInterval time.Duration
+	// Debounce is how long changes must settle before they are reported,
+	// so a burst of saves to the same note is reported once
+	Debounce time.Duration
+	// MaxWait caps how long a change waits to be reported while new
+	// changes keep arriving. Zero means no cap.
+	MaxWait time.Duration
+}
+
+// Watcher is implemented by backends that can report changes to notes
+type Watcher interface {
+	// Watch calls fn with batches of note changes until ctx is done
+	Watch(ctx context.Context, opts WatchOptions, fn func([]NoteChange)) error
+}
+
+// debounceChanges collects changes from in and calls fn with them once no
+// new change has arrived for opts.Debounce, or once the oldest pending
+// change has waited opts.MaxWait. Changes to the same note are merged into
+// one.
+func debounceChanges(ctx context.Context, in <-chan NoteChange, opts WatchOptions, fn func([]NoteChange)) {
+	pending := make(map[string]string)
+	var order []string
+	var first time.Time
+	timer := time.NewTimer(opts.Debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case change := <-in:
+			if len(order) == 0 {
+				first = time.Now()
+			}
+			previous, seen := pending[change.Path]
+			if !seen {
+				order = append(order, change.Path)
+			}
+			pending[change.Path] = mergeChange(previous, change.Kind)
+			wait := opts.Debounce
+			if opts.MaxWait > 0 {
+				wait = min(wait, opts.MaxWait-time.Since(first))
+			}
+			timer.Reset(wait)
+		case <-timer.C:
+			var batch []NoteChange
+			for _, path := range order {
+				if kind := pending[path]; kind != "" {
+					batch = append(batch, NoteChange{Path: path, Kind: kind})
+				}
+			}
+			pending = make(map[string]string)
+			order = nil
+			if len(batch) > 0 {
+				fn(batch)
+			}
+		}
+	}
+}
+
+// mergeChange combines a pending change with a newer one to the same note.
+// An empty result means the changes cancel out.
+func mergeChange(previous, next string) string {
+	switch {
+	case previous == NoteCreated && next == NoteDeleted:
+		return ""
+	case previous == NoteCreated:
+		return NoteCreated
+	case previous == NoteDeleted && next == NoteCreated:
+		return NoteModified
+	default:
+		return next
+	}
+}
+
+// sendChange sends a change to out unless ctx is done first
+func sendChange(ctx context.Context, out chan<- NoteChange, path, kind string) {
+	select {
+	case out <- NoteChange{Path: path, Kind: kind}:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDebounceChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	in := make(chan NoteChange)
+	batches := make(chan []NoteChange, 1)
+	go debounceChanges(ctx, in, WatchOptions{Debounce: 20 * time.Millisecond}, func(batch []NoteChange) {
+		batches <- batch
+	})
+
+	in <- NoteChange{Path: "a.md", Kind: NoteCreated}
+	in <- NoteChange{Path: "b.md", Kind: NoteModified}
+	in <- NoteChange{Path: "a.md", Kind: NoteModified}
+	in <- NoteChange{Path: "c.md", Kind: NoteCreated}
+	in <- NoteChange{Path: "c.md", Kind: NoteDeleted}
+
+	want := []NoteChange{{Path: "a.md", Kind: NoteCreated}, {Path: "b.md", Kind: NoteModified}}
+	select {
+	case got := <-batches:
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("batch = %v, want %v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no batch reported")
+	}
+}
+
+func TestDebounceChangesMaxWait(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	in := make(chan NoteChange)
+	batches := make(chan []NoteChange, 10)
+	opts := WatchOptions{Debounce: 50 * time.Millisecond, MaxWait: 100 * time.Millisecond}
+	go debounceChanges(ctx, in, opts, func(batch []NoteChange) {
+		batches <- batch
+	})
+
+	// Keep changing the note more often than the debounce period
+	start := time.Now()
+	for time.Since(start) < 500*time.Millisecond {
+		in <- NoteChange{Path: "a.md", Kind: NoteModified}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if len(batches) == 0 {
+		t.Error("no batch reported while changes kept arriving")
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"obsidian-mcp/api"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Defaults for rotating the audit log
+const (
+	defaultAuditMaxSize    = 10 << 20 // bytes
+	defaultAuditMaxBackups = 5
+)
+
+// auditKey holds the audit record of a tool call in its context
+const auditKey contextKey = "audit"
+
+// AuditConfig configures the audit log of tool calls that modify the vault
+type AuditConfig struct {
+	Path       string `yaml:"path"`        // JSON Lines file, auditing is off if empty
+	MaxSize    int64  `yaml:"max_size"`    // bytes after which the log is rotated, 0 never rotates
+	MaxBackups int    `yaml:"max_backups"` // rotated files to keep as path.1, path.2, ...
+}
+
+// auditRecord is one line of the audit log
+type auditRecord struct {
+	Time    string   `json:"time"` // RFC 3339 with milliseconds, UTC
+	Session string   `json:"session,omitempty"`
+	Client  string   `json:"client,omitempty"` // name and version from initialize
+	Token   string   `json:"token,omitempty"`  // name of the HTTP auth token
+	Tool    string   `json:"tool"`
+	Vault   string   `json:"vault"`
+	Path    string   `json:"path,omitempty"`
+	To      string   `json:"to,omitempty"`     // destination of moves, restores and deletes
+	Before  string   `json:"before,omitempty"` // version of path before the call, empty if it didn't exist
+	After   string   `json:"after,omitempty"`  // version of to, or else path, after the call
+	Outcome string   `json:"outcome"`          // ok, or the error code of the failure
+	Error   string   `json:"error,omitempty"`
+	Purged  []string `json:"purged,omitempty"` // notes empty_trash deleted for good, by where they were deleted from
+
+	// checked is set once the tool has validated its paths and checked
+	// them against the policy, so the notes may be read for their versions
+	checked bool
+}
+
+// auditTarget holds the parameters of a tool call that name notes
+type auditTarget struct {
+	Path  string `json:"path"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Vault string `json:"vault"`
+}
+
+// auditLog appends records to a JSON Lines file, rotating it by size
+type auditLog struct {
+	config AuditConfig
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// newAuditLog opens the audit log for appending. It returns nil when no
+// path is configured.
+func newAuditLog(config AuditConfig) (*auditLog, error) {
+	if config.Path == "" {
+		return nil, nil
+	}
+	l := &auditLog{config: config}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *auditLog) open() error {
+	file, err := os.OpenFile(l.config.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open audit log: %v", err)
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+// write appends a record, rotating the log first if the record would take
+// it past its maximum size
+func (l *auditLog) write(record auditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.config.MaxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.config.MaxSize {
+		if err := l.rotate(); err != nil {
+			// Keep the record, in the current log if it can't be rotated
+			log.Printf("Warning: failed to rotate audit log: %v", err)
+			if l.file == nil {
+				return err
+			}
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	return err
+}
+
+// rotate renames the log to path.1, shifting older backups up and
+// removing those beyond the number to keep, and reopens the log
+func (l *auditLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+	err := l.shiftBackups()
+	if openErr := l.open(); openErr != nil {
+		return openErr
+	}
+	return err
+}
+
+// shiftBackups moves the closed log to path.1 and older backups up by one
+func (l *auditLog) shiftBackups() error {
+	if l.config.MaxBackups <= 0 {
+		return os.Remove(l.config.Path)
+	}
+	backup := func(n int) string { return fmt.Sprintf("%s.%d", l.config.Path, n) }
+
+	if err := os.Remove(backup(l.config.MaxBackups)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for n := l.config.MaxBackups - 1; n >= 1; n-- {
+		if err := os.Rename(backup(n), backup(n+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(l.config.Path, backup(1))
+}
+
+// Close closes the log file
+func (l *auditLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// begin starts the audit record of a tool call. The version of the note
+// it targets is noted later by recordAuditBefore, once the tool has
+// checked the path.
+func (l *auditLog) begin(ctx context.Context, req *mcp.CallToolRequest, input any) *auditRecord {
+	var target auditTarget
+	if data, err := json.Marshal(input); err == nil {
+		json.Unmarshal(data, &target)
+	}
+
+	record := &auditRecord{
+		Tool:  req.Params.Name,
+		Vault: ctx.Value(vaultsKey).(*vaultRegistry).resolve(target.Vault),
+		Path:  target.Path,
+		To:    target.To,
+	}
+	if target.From != "" {
+		record.Path = target.From
+	}
+	if record.Path != "" {
+		record.Path = api.NormalizeNotePath(record.Path)
+	}
+	if record.To != "" {
+		record.To = api.NormalizeNotePath(record.To)
+	}
+
+	if session := req.Session; session != nil {
+		record.Session = session.ID()
+		if params := session.InitializeParams(); params != nil && params.ClientInfo != nil {
+			record.Client = params.ClientInfo.Name + " " + params.ClientInfo.Version
+		}
+	}
+	if info := tokenInfo(ctx, req); info != nil {
+		record.Token = fmt.Sprint(info.Extra["name"])
+	}
+	return record
+}
+
+// end completes the audit record of a tool call with its outcome and the
+// resulting note version, and writes it
+func (l *auditLog) end(ctx context.Context, record *auditRecord, err error) {
+	record.Time = time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00")
+	record.Outcome = "ok"
+	if err != nil {
+		record.Outcome = errorCode(err)
+		record.Error = err.Error()
+	}
+	if after := record.To; record.checked && (after != "" || record.Path != "") {
+		if after == "" {
+			after = record.Path
+		}
+		record.After = noteVersion(ctx, record.Vault, after)
+	}
+
+	if err := l.write(*record); err != nil {
+		log.Printf("Warning: failed to write audit log: %v", err)
+	}
+}
+
+// recordAuditBefore notes the version of the tool call's note before the
+// call. Tools call it after validating their paths and checking the
+// policy, so notes the call may not touch are never read for the log.
+func recordAuditBefore(ctx context.Context) {
+	if record, ok := ctx.Value(auditKey).(*auditRecord); ok {
+		record.checked = true
+		if record.Path != "" {
+			record.Before = noteVersion(ctx, record.Vault, record.Path)
+		}
+	}
+}
+
+// setAuditDestination records where a tool call moved its note, for calls
+// whose destination is not a parameter
+func setAuditDestination(ctx context.Context, notePath string) {
+	if record, ok := ctx.Value(auditKey).(*auditRecord); ok {
+		record.To = notePath
+	}
+}
+
+// setAuditPurged records the notes a tool call deleted permanently
+func setAuditPurged(ctx context.Context, notePaths []string) {
+	if record, ok := ctx.Value(auditKey).(*auditRecord); ok {
+		record.Purged = notePaths
+	}
+}
+
+// noteVersion returns the version of a note, or "" if it cannot be read.
+// It runs even when the tool call was cancelled.
+func noteVersion(ctx context.Context, vaultName, notePath string) string {
+	vault, err := vaultFromContext(ctx, vaultName)
+	if err != nil {
+		return ""
+	}
+	content, err := vault.GetNote(context.WithoutCancel(ctx), notePath)
+	if err != nil {
+		return ""
+	}
+	return api.NoteVersion(content)
+}
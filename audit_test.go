@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"obsidian-mcp/api"
+	"obsidian-mcp/security"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestAuditVersions(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "Private"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.md", "Private/b.md"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("old"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vault, err := api.NewFileSystemVault(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := security.NewPolicy(security.PolicyConfig{PolicyRules: security.PolicyRules{Deny: []string{"Private/**"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := &vaultRegistry{
+		configs:      []VaultConfig{{Name: "default"}},
+		backends:     map[string]api.VaultBackend{"default": vault},
+		defaultVault: "default",
+		policy:       policy,
+	}
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := newAuditLog(AuditConfig{Path: logPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer audit.Close()
+
+	tests := []struct {
+		path       string
+		wantBefore string
+		wantAfter  string
+	}{
+		{path: "a.md", wantBefore: api.NoteVersion("old"), wantAfter: api.NoteVersion("new")},
+		// Notes the policy denies aren't read for the log
+		{path: "Private/b.md"},
+		{path: "../outside.md"},
+	}
+
+	for _, tt := range tests {
+		ctx := context.WithValue(context.Background(), vaultsKey, registry)
+		input := UpdateNoteInput{Path: tt.path, Content: "new"}
+		req := &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "update_note"}}
+		record := audit.begin(ctx, req, input)
+		ctx = context.WithValue(ctx, auditKey, record)
+		_, _, err := UpdateNote(ctx, req, input)
+		audit.end(ctx, record, err)
+
+		if record.Before != tt.wantBefore || record.After != tt.wantAfter {
+			t.Errorf("%s: before = %q, after = %q; want %q, %q", tt.path, record.Before, record.After, tt.wantBefore, tt.wantAfter)
+		}
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first auditRecord
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&first); err != nil || first.Outcome != "ok" {
+		t.Errorf("first record = %+v, %v", first, err)
+	}
+}
+
+func TestAuditEmptyTrash(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, ".trash"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.md", ".trash/b.md"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vault, err := api.NewFileSystemVault(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := &vaultRegistry{
+		configs:      []VaultConfig{{Name: "default"}},
+		backends:     map[string]api.VaultBackend{"default": vault},
+		defaultVault: "default",
+	}
+	audit, err := newAuditLog(AuditConfig{Path: filepath.Join(t.TempDir(), "audit.log")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer audit.Close()
+
+	ctx := context.WithValue(context.Background(), vaultsKey, registry)
+	if _, err := api.TrashNote(ctx, vault, api.DefaultTrashFolder, "a.md"); err != nil {
+		t.Fatal(err)
+	}
+	input := EmptyTrashInput{}
+	req := &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "empty_trash"}}
+	record := audit.begin(ctx, req, input)
+	ctx = context.WithValue(ctx, auditKey, record)
+	_, _, err = EmptyTrash(ctx, req, input)
+	audit.end(ctx, record, err)
+
+	// Notes are named by where they were deleted from when that is known
+	if want := []string{"a.md", ".trash/b.md"}; err != nil || !slices.Equal(record.Purged, want) {
+		t.Errorf("empty_trash recorded %v (%v), want %v", record.Purged, err, want)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Token scopes
+const (
+	scopeRead  = "read"
+	scopeWrite = "write"
+)
+
+// Values accepted for AuthToken.Scope
+const (
+	accessReadOnly  = "read-only"
+	accessReadWrite = "read-write"
+)
+
+// AuthToken is a static bearer token accepted by the HTTP transports
+type AuthToken struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+	Scope string `yaml:"scope"` // read-only (default) or read-write
+}
+
+// AuthConfig configures authentication for the HTTP transports
+type AuthConfig struct {
+	Tokens         []AuthToken `yaml:"tokens"`
+	AllowedOrigins []string    `yaml:"allowed_origins"`
+	AllowedHosts   []string    `yaml:"allowed_hosts"`
+	// AllowUnauthenticated serves a non-loopback address without tokens
+	AllowUnauthenticated bool `yaml:"allow_unauthenticated"`
+}
+
+// errForbidden is returned for tool calls the token's scopes do not allow
+var errForbidden = errors.New("forbidden")
+
+// toolAccess records which registered tools only read from the vault
+var toolAccess = map[string]bool{}
+
+// scopesFor returns the token scopes granted by an access level
+func scopesFor(access string) ([]string, error) {
+	switch access {
+	case "", accessReadOnly:
+		return []string{scopeRead}, nil
+	case accessReadWrite:
+		return []string{scopeRead, scopeWrite}, nil
+	default:
+		return nil, fmt.Errorf("unknown token scope %q (expected %s or %s)", access, accessReadOnly, accessReadWrite)
+	}
+}
+
+// newTokenVerifier returns a verifier that accepts the configured static tokens
+func newTokenVerifier(tokens []AuthToken) (auth.TokenVerifier, error) {
+	infos := make([]*auth.TokenInfo, len(tokens))
+	for i, t := range tokens {
+		if t.Token == "" {
+			return nil, fmt.Errorf("auth token %q has no token value", t.Name)
+		}
+		scopes, err := scopesFor(t.Scope)
+		if err != nil {
+			return nil, fmt.Errorf("auth token %q: %v", t.Name, err)
+		}
+		infos[i] = &auth.TokenInfo{
+			Scopes: scopes,
+			// Static tokens do not expire, but the SDK requires an expiration
+			Expiration: time.Now().AddDate(100, 0, 0),
+			Extra:      map[string]any{"name": t.Name},
+		}
+	}
+
+	return func(ctx context.Context, token string, req *http.Request) (*auth.TokenInfo, error) {
+		for i, t := range tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+				return infos[i], nil
+			}
+		}
+		return nil, fmt.Errorf("%w: unknown bearer token", auth.ErrInvalidToken)
+	}, nil
+}
+
+// withAuth wraps handler with origin/host validation and, when tokens are
+// configured, bearer token authentication. Rejected requests are logged.
+// Without tokens only loopback addresses are served, unless
+// allow_unauthenticated is set.
+func withAuth(handler http.Handler, config Config) (http.Handler, error) {
+	switch {
+	case len(config.Server.Auth.Tokens) > 0:
+		verifier, err := newTokenVerifier(config.Server.Auth.Tokens)
+		if err != nil {
+			return nil, err
+		}
+		handler = auth.RequireBearerToken(verifier, nil)(handler)
+	case isLoopbackAddress(config.Server.Address) || config.Server.Auth.AllowUnauthenticated:
+		log.Println("Warning: no auth tokens configured, HTTP transport accepts unauthenticated requests")
+	default:
+		return nil, fmt.Errorf("refusing to listen on %q without auth tokens: configure server.auth.tokens, listen on a loopback address, or set server.auth.allow_unauthenticated: true", config.Server.Address)
+	}
+
+	allowedHosts := config.Server.Auth.AllowedHosts
+	if len(allowedHosts) == 0 && isLoopbackAddress(config.Server.Address) {
+		allowedHosts = []string{"localhost", "127.0.0.1", "::1"}
+	}
+	handler = checkOrigin(handler, allowedHosts, config.Server.Auth.AllowedOrigins)
+
+	return logRejections(handler), nil
+}
+
+// checkOrigin rejects requests whose Host header is not an allowed host, or
+// whose Origin header is neither same-origin nor explicitly allowed. This
+// protects local servers against DNS rebinding from a browser.
+func checkOrigin(next http.Handler, allowedHosts, allowedOrigins []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(allowedHosts) > 0 && !slices.Contains(allowedHosts, hostname(r.Host)) {
+			http.Error(w, "forbidden: host not allowed", http.StatusForbidden)
+			return
+		}
+
+		if origin := r.Header.Get("Origin"); origin != "" && !slices.Contains(allowedOrigins, origin) {
+			u, err := url.Parse(origin)
+			if err != nil || u.Host != r.Host {
+				http.Error(w, "forbidden: origin not allowed", http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush forwards to the underlying writer so streaming responses keep working
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// logRejections logs requests that were answered with 401 or 403
+func logRejections(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == http.StatusUnauthorized || rec.status == http.StatusForbidden {
+			log.Printf("Rejected %s %s from %s: %d %s (host=%q origin=%q)",
+				r.Method, r.URL.Path, r.RemoteAddr, rec.status, http.StatusText(rec.status), r.Host, r.Header.Get("Origin"))
+		}
+	})
+}
+
+// requireScopes is MCP middleware that rejects calls to tools which modify
+// the vault unless the caller's token carries the write scope. Requests
+// without token information (stdio, or HTTP without auth) are not restricted.
+func requireScopes(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		call, ok := req.(*mcp.CallToolRequest)
+		if !ok || toolAccess[call.Params.Name] {
+			return next(ctx, method, req)
+		}
+
+		if info := tokenInfo(ctx, req); info != nil && !slices.Contains(info.Scopes, scopeWrite) {
+			log.Printf("Rejected tool call %s: token %v lacks %s scope", call.Params.Name, info.Extra["name"], scopeWrite)
+			return toolError(fmt.Errorf("%w: tool %s requires a read-write token", errForbidden, call.Params.Name)), nil
+		}
+
+		return next(ctx, method, req)
+	}
+}
+
+// tokenInfo returns the bearer token the caller of a request authenticated
+// with, or nil for requests without token information
+func tokenInfo(ctx context.Context, req mcp.Request) *auth.TokenInfo {
+	if extra := req.GetExtra(); extra != nil && extra.TokenInfo != nil {
+		return extra.TokenInfo
+	}
+	// The SSE transport carries the token of the request that opened the session
+	return auth.TokenInfoFromContext(ctx)
+}
+
+// hostname strips the port from a Host header value
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return strings.Trim(host, "[]")
+}
+
+// isLoopbackAddress reports whether a listen address only binds to loopback
+func isLoopbackAddress(address string) bool {
+	host := hostname(address)
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
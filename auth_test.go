@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestWithAuthUnauthenticated(t *testing.T) {
+	tests := []struct {
+		address string
+		tokens  []AuthToken
+		allow   bool
+		wantErr bool
+	}{
+		{address: "localhost:8080"},
+		{address: "127.0.0.1:8080"},
+		{address: "[::1]:8080"},
+		{address: "0.0.0.0:8080", wantErr: true},
+		{address: ":8080", wantErr: true},
+		{address: "192.168.1.5:8080", wantErr: true},
+		{address: "0.0.0.0:8080", allow: true},
+		{address: "0.0.0.0:8080", tokens: []AuthToken{{Name: "agent", Token: "secret"}}},
+	}
+
+	for _, tt := range tests {
+		var config Config
+		config.Server.Address = tt.address
+		config.Server.Auth.Tokens = tt.tokens
+		config.Server.Auth.AllowUnauthenticated = tt.allow
+
+		_, err := withAuth(http.NotFoundHandler(), config)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("withAuth(%q, %d tokens, allow=%t) error = %v, want error %t", tt.address, len(tt.tokens), tt.allow, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"obsidian-mcp/api"
+	"obsidian-mcp/search"
+	"obsidian-mcp/security"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Error codes of failed tool calls, so clients can react to a failure
+// without parsing its message
+const (
+	codeNotFound      = "not_found"
+	codeAlreadyExists = "already_exists"
+	codeUnauthorized  = "unauthorized"
+	codeForbidden     = "forbidden"
+	codeConflict      = "conflict"
+	codeUnavailable   = "unavailable"
+	codeInvalidPath   = "invalid_path"
+	codeInvalidArg    = "invalid_argument"
+	codeInvalidQuery  = "invalid_query"
+	codeUnsupported   = "unsupported"
+	codeInvalidCursor = "invalid_cursor"
+	codeTimeout       = "timeout"
+	codeCancelled     = "cancelled"
+	codeCertificate   = "untrusted_certificate"
+	codeError         = "error" // any other failure
+)
+
+// errorCodeMeta is the _meta key holding the code of a failed tool call
+const errorCodeMeta = "errorCode"
+
+// toolErrorKey holds a slot in the context of a tool call for the error
+// returned by its handler
+const toolErrorKey contextKey = "toolError"
+
+// errorCodes maps typed errors to their codes, checked in order
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{api.ErrNotFound, codeNotFound},
+	{api.ErrAlreadyExists, codeAlreadyExists},
+	{api.ErrUnauthorized, codeUnauthorized},
+	{errForbidden, codeForbidden},
+	{security.ErrDenied, codeForbidden},
+	{api.ErrConflict, codeConflict},
+	{security.ErrInvalidPath, codeInvalidPath},
+	{api.ErrInvalidArgument, codeInvalidArg},
+	{search.ErrInvalidQuery, codeInvalidQuery},
+	{errors.ErrUnsupported, codeUnsupported},
+	{errInvalidCursor, codeInvalidCursor},
+	{api.ErrTimeout, codeTimeout},
+	{api.ErrCanceled, codeCancelled},
+	{api.ErrCertificate, codeCertificate},
+	{api.ErrUnavailable, codeUnavailable},
+}
+
+// errorCode returns the code of an error
+func errorCode(err error) string {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return codeError
+}
+
+// toolError returns the result of a tool call that failed with err, for
+// failures produced outside the tool handler
+func toolError(err error) *mcp.CallToolResult {
+	result := &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		IsError: true,
+	}
+	result.Meta = mcp.Meta{errorCodeMeta: errorCode(err)}
+	return result
+}
+
+// recordToolError stores the error returned by a tool handler in the slot
+// of the call's context
+func recordToolError(ctx context.Context, err error) {
+	if slot, ok := ctx.Value(toolErrorKey).(*error); ok {
+		*slot = err
+	}
+}
+
+// withErrorCodes is middleware that adds the code of the error a tool call
+// failed with to the _meta of its result
+func withErrorCodes(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if _, ok := req.(*mcp.CallToolRequest); !ok {
+			return next(ctx, method, req)
+		}
+
+		var failure error
+		result, err := next(context.WithValue(ctx, toolErrorKey, &failure), method, req)
+		res, ok := result.(*mcp.CallToolResult)
+		if err != nil || !ok || !res.IsError || res.Meta[errorCodeMeta] != nil {
+			return result, err
+		}
+		res.Meta = mcp.Meta{errorCodeMeta: errorCode(failure)}
+		return res, nil
+	}
+}
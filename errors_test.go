@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"obsidian-mcp/api"
+	"obsidian-mcp/search"
+	"obsidian-mcp/security"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{api.ErrNotFound, codeNotFound},
+		{api.ErrAlreadyExists, codeAlreadyExists},
+		{api.ErrUnauthorized, codeUnauthorized},
+		{errForbidden, codeForbidden},
+		{security.ErrDenied, codeForbidden},
+		{api.ErrConflict, codeConflict},
+		{security.ErrInvalidPath, codeInvalidPath},
+		{api.ErrInvalidArgument, codeInvalidArg},
+		{search.ErrInvalidQuery, codeInvalidQuery},
+		{errors.ErrUnsupported, codeUnsupported},
+		{errInvalidCursor, codeInvalidCursor},
+		{api.ErrTimeout, codeTimeout},
+		{api.ErrCanceled, codeCancelled},
+		{api.ErrCertificate, codeCertificate},
+		{api.ErrUnavailable, codeUnavailable},
+		{errors.New("disk full"), codeError},
+		// The first match wins: a certificate failure also leaves Obsidian
+		// unreachable
+		{errors.Join(api.ErrUnavailable, api.ErrCertificate), codeCertificate},
+	}
+
+	for _, tt := range tests {
+		if got := errorCode(fmt.Errorf("failed to get note: %w", tt.err)); got != tt.want {
+			t.Errorf("errorCode(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWithErrorCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   *mcp.CallToolResult
+		failure  error
+		wantCode any
+	}{
+		{"failed", &mcp.CallToolResult{IsError: true}, fmt.Errorf("failed to get note: %w", api.ErrNotFound), codeNotFound},
+		{"failed without a typed error", &mcp.CallToolResult{IsError: true}, errors.New("disk full"), codeError},
+		{"succeeded", &mcp.CallToolResult{}, nil, nil},
+		{"code already set", &mcp.CallToolResult{IsError: true, Meta: mcp.Meta{errorCodeMeta: codeTimeout}}, api.ErrNotFound, codeTimeout},
+	}
+
+	for _, tt := range tests {
+		handler := withErrorCodes(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			if tt.failure != nil {
+				recordToolError(ctx, tt.failure)
+			}
+			return tt.result, nil
+		})
+		result, err := handler(context.Background(), "tools/call", &mcp.CallToolRequest{})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := result.(*mcp.CallToolResult).Meta[errorCodeMeta]; got != tt.wantCode {
+			t.Errorf("%s: error code %v, want %v", tt.name, got, tt.wantCode)
+		}
+	}
+}
+
+func TestInvalidPathErrors(t *testing.T) {
+	vault, err := api.NewFileSystemVault(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := &vaultRegistry{
+		configs:      []VaultConfig{{Name: "default"}},
+		backends:     map[string]api.VaultBackend{"default": vault},
+		defaultVault: "default",
+	}
+	ctx := context.WithValue(context.Background(), vaultsKey, registry)
+
+	tests := []struct {
+		name string
+		call func() error
+		want string
+	}{
+		{"get_note", func() error {
+			_, _, err := GetNote(ctx, nil, GetNoteInput{Path: "../a.md"})
+			return err
+		}, "invalid path: directory traversal not allowed"},
+		{"move_note", func() error {
+			_, _, err := MoveNote(ctx, nil, MoveNoteInput{From: "a.md", To: "/b.md"})
+			return err
+		}, "destination: invalid path: absolute paths not allowed"},
+		{"list_notes", func() error {
+			_, _, err := ListNotes(ctx, nil, ListNotesInput{Folder: "../x"})
+			return err
+		}, "folder: invalid path: directory traversal not allowed"},
+	}
+
+	for _, tt := range tests {
+		err := tt.call()
+		if err == nil || err.Error() != tt.want || errorCode(err) != codeInvalidPath {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"obsidian-mcp/api"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// textResult returns a tool result whose display content is text. The
+// structured output of the tool is added alongside it by the SDK.
+func textResult(text string) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: text}},
+	}
+}
+
+// formatNote formats a note with a heading naming its path and version
+func formatNote(path, version, content string) string {
+	return fmt.Sprintf("# Note: %s\nVersion: %s\n\n%s", path, version, content)
+}
+
+// formatNotesList formats a page of listed entries as a markdown list,
+// marking folders with a trailing slash, and tells how to get the next page
+func formatNotesList(page NotesListOutput) string {
+	if page.Total == 0 {
+		if page.Folder != "" {
+			return fmt.Sprintf("Folder '%s' is empty or does not exist yet. No notes found.", page.Folder)
+		}
+		return "No notes found."
+	}
+	if page.Count == 0 {
+		return fmt.Sprintf("Found %d entries, none after offset %d.", page.Total, page.Offset)
+	}
+
+	output := fmt.Sprintf("Found %d entries", page.Total)
+	if page.Count < page.Total {
+		output += fmt.Sprintf(", showing %d-%d", page.Offset+1, page.Offset+page.Count)
+	}
+	output += ":\n"
+	for _, entry := range page.Entries {
+		switch entry.Type {
+		case api.EntryFolder:
+			output += fmt.Sprintf("- %s/\n", entry.Path)
+		case api.EntryAttachment:
+			output += fmt.Sprintf("- %s (attachment)\n", entry.Path)
+		default:
+			output += fmt.Sprintf("- %s\n", entry.Path)
+		}
+	}
+	if page.NextCursor != "" {
+		output += fmt.Sprintf("More entries: call again with cursor \"%s\".\n", page.NextCursor)
+	}
+
+	return output
+}
+
+// formatSearchResults formats a page of search results as a numbered
+// markdown list with the context of every match, and tells how to get the
+// next page
+func formatSearchResults(page SearchResultOutput) string {
+	if page.Total == 0 {
+		return fmt.Sprintf("No notes found matching \"%s\".", page.Query)
+	}
+	if page.Count == 0 {
+		return fmt.Sprintf("Found %d notes matching \"%s\", none after offset %d.", page.Total, page.Query, page.Offset)
+	}
+
+	output := fmt.Sprintf("Found %d notes matching \"%s\"", page.Total, page.Query)
+	if page.Count < page.Total {
+		output += fmt.Sprintf(", showing %d-%d", page.Offset+1, page.Offset+page.Count)
+	}
+	output += ":\n\n"
+	for i, result := range page.Results {
+		output += fmt.Sprintf("%d. **%s**", page.Offset+i+1, result.Path)
+		if result.Score > 0 {
+			output += fmt.Sprintf(" (score %.2f)", result.Score)
+		}
+		output += "\n"
+		for _, match := range result.Matches {
+			output += fmt.Sprintf("   > %s\n", strings.TrimSpace(match.Context))
+		}
+		output += "\n"
+	}
+	if page.NextCursor != "" {
+		output += fmt.Sprintf("More results: call again with cursor \"%s\".\n", page.NextCursor)
+	}
+
+	return output
+}
+
+// formatQueryRows formats the rows of a vault query as a markdown list,
+// with the values of each row encoded as JSON
+func formatQueryRows(rows []api.QueryRow) string {
+	if len(rows) == 0 {
+		return "The query found no notes."
+	}
+
+	output := fmt.Sprintf("The query found %d notes:\n", len(rows))
+	for _, row := range rows {
+		value, err := json.Marshal(row.Result)
+		if err != nil {
+			value = []byte(fmt.Sprint(row.Result))
+		}
+		output += fmt.Sprintf("- **%s:** %s\n", row.Path, value)
+	}
+
+	return output
+}
+
+// formatVaultInfo formats vault information as markdown
+func formatVaultInfo(info api.VaultInfo) string {
+	result := "# Vault Information\n\n"
+
+	if info.Name != "" {
+		result += fmt.Sprintf("**Vault:** %s\n", info.Name)
+	}
+	result += fmt.Sprintf("**Authenticated:** %v\n", info.Authenticated)
+	if info.Service != "" {
+		result += fmt.Sprintf("**Service:** %s\n", info.Service)
+	}
+	if info.Path != "" {
+		result += fmt.Sprintf("**Path:** %s\n", info.Path)
+	}
+
+	if len(info.Versions) > 0 {
+		result += "\n## Versions\n"
+		keys := make([]string, 0, len(info.Versions))
+		for key := range info.Versions {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			result += fmt.Sprintf("- **%s:** %s\n", key, info.Versions[key])
+		}
+	}
+
+	result += "\n## Statistics\n"
+	result += fmt.Sprintf("- **Notes:** %d\n", info.NotesCount)
+	result += fmt.Sprintf("- **Folders:** %d\n", info.FoldersCount)
+
+	return result
+}
+
+// formatFrontmatter formats frontmatter properties as a markdown list in
+// document order, with values encoded as JSON
+func formatFrontmatter(path string, values map[string]interface{}, keys []string) string {
+	if len(keys) == 0 {
+		return fmt.Sprintf("Note '%s' has no frontmatter.", path)
+	}
+
+	result := fmt.Sprintf("# Frontmatter: %s\n\n", path)
+	for _, key := range keys {
+		value, err := json.Marshal(values[key])
+		if err != nil {
+			value = []byte(fmt.Sprint(values[key]))
+		}
+		result += fmt.Sprintf("- **%s:** %s\n", key, value)
+	}
+
+	return result
+}
+
+// formatTrash formats the notes in a trash folder as a markdown list
+func formatTrash(folder string, entries []api.TrashEntry) string {
+	if len(entries) == 0 {
+		return fmt.Sprintf("The trash folder '%s' is empty.", folder)
+	}
+
+	result := fmt.Sprintf("Found %d notes in %s:\n", len(entries), folder)
+	for _, entry := range entries {
+		if entry.OriginalPath == "" {
+			result += fmt.Sprintf("- %s (origin unknown)\n", entry.Path)
+			continue
+		}
+		result += fmt.Sprintf("- %s (deleted from %s at %s)\n", entry.Path, entry.OriginalPath, entry.DeletedAt)
+	}
+
+	return result
+}
+
+// formatMoveResult summarizes a note move and the links it rewrote
+func formatMoveResult(result api.MoveResult) string {
+	var output string
+	if result.DryRun {
+		output = fmt.Sprintf("Dry run: moving %s -> %s would update %d links in %d notes", result.From, result.To, result.LinksUpdated, len(result.UpdatedNotes))
+	} else {
+		output = fmt.Sprintf("Successfully moved note: %s -> %s (updated %d links in %d notes)", result.From, result.To, result.LinksUpdated, len(result.UpdatedNotes))
+	}
+	if len(result.UpdatedNotes) == 0 {
+		output += "\n"
+	} else {
+		output += ":\n"
+		for _, update := range result.UpdatedNotes {
+			output += fmt.Sprintf("- %s (%d links", update.Path, update.Links)
+			if update.Pinned > 0 {
+				output += fmt.Sprintf(", %d pinned to their current target", update.Pinned)
+			}
+			output += ")\n"
+		}
+	}
+	if len(result.NotUpdated) > 0 {
+		output += fmt.Sprintf("Links could not be updated in: %s\n", strings.Join(result.NotUpdated, ", "))
+	}
+	if result.Unreadable > 0 {
+		output += fmt.Sprintf("%d notes the access policy doesn't let you read were not checked for links\n", result.Unreadable)
+	}
+	return output
+}
@@ -2,11 +2,22 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 
 	"obsidian-mcp/api"
+	"obsidian-mcp/search"
 	"obsidian-mcp/security"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
@@ -16,184 +27,940 @@ import (
 // Config represents the server configuration
 type Config struct {
 	ObsidianAPI struct {
-		BaseURL string `yaml:"base_url"`
-		Token   string `yaml:"token"`
-		Port    int    `yaml:"port"`
+		BaseURL string        `yaml:"base_url"`
+		Token   string        `yaml:"token"`
+		Port    int           `yaml:"port"`
+		Timeout time.Duration `yaml:"timeout"` // per request
+		Retry   RetryConfig   `yaml:"retry"`
+		TLS     TLSConfig     `yaml:"tls"` // for the https port
 	} `yaml:"obsidian_api"`
-	MCP struct {
+	Vault struct {
+		Backend     string `yaml:"backend"`      // rest or filesystem
+		Path        string `yaml:"path"`         // vault directory for the filesystem backend
+		TrashFolder string `yaml:"trash_folder"` // where delete_note moves notes
+	} `yaml:"vault"`
+	Vaults       []VaultConfig `yaml:"vaults"`
+	DefaultVault string        `yaml:"default_vault"`
+	MCP          struct {
 		Description string `yaml:"description"`
 	} `yaml:"mcp"`
+	Server struct {
+		Transport   string        `yaml:"transport"` // stdio, http or sse
+		Address     string        `yaml:"address"`
+		TLSCert     string        `yaml:"tls_cert"`
+		TLSKey      string        `yaml:"tls_key"`
+		Auth        AuthConfig    `yaml:"auth"`
+		ToolTimeout time.Duration `yaml:"tool_timeout"` // whole tool call or resource read
+	} `yaml:"server"`
+	Tools  ToolsConfig           `yaml:"tools"`
+	Policy security.PolicyConfig `yaml:"policy"` // paths tools may read, write and delete
+	Audit  AuditConfig           `yaml:"audit"`
+	Search struct {
+		Index    bool   `yaml:"index"`     // search with a local full-text index
+		IndexDir string `yaml:"index_dir"` // where indexes are saved, the user cache directory by default
+	} `yaml:"search"`
+	Watch struct {
+		Enabled      bool          `yaml:"enabled"`
+		PollInterval time.Duration `yaml:"poll_interval"` // rest backend only, which isn't watched when zero
+		Debounce     time.Duration `yaml:"debounce"`
+		MaxWait      time.Duration `yaml:"max_wait"`
+	} `yaml:"watch"`
 }
 
 // contextKey type for context values
 type contextKey string
 
-const apiKey contextKey = "api"
+const vaultsKey contextKey = "vaults"
+
+// defaultBaseURL is the Local REST API plugin's default address
+const defaultBaseURL = "http://localhost:27123"
 
 // Tool Input/Output types
 
 type GetNoteInput struct {
-	Path string `json:"path" jsonschema:"description:Path to the note file"`
+	Path  string `json:"path" jsonschema:"description:Path to the note file"`
+	Vault string `json:"vault,omitempty" jsonschema:"description:Optional vault name, defaults to the default vault"`
 }
 
 type CreateNoteInput struct {
-	Path    string `json:"path" jsonschema:"description:Path where the note should be created"`
-	Content string `json:"content" jsonschema:"description:Content of the note"`
+	Path      string `json:"path" jsonschema:"description:Path where the note should be created"`
+	Content   string `json:"content" jsonschema:"description:Content of the note"`
+	Overwrite bool   `json:"overwrite,omitempty" jsonschema:"description:Replace the note if it already exists instead of failing"`
+	Vault     string `json:"vault,omitempty" jsonschema:"description:Optional vault name, defaults to the default vault"`
 }
 
 type UpdateNoteInput struct {
-	Path    string `json:"path" jsonschema:"description:Path to the note to update"`
-	Content string `json:"content" jsonschema:"description:New content for the note"`
+	Path            string `json:"path" jsonschema:"description:Path to the note to update"`
+	Content         string `json:"content" jsonschema:"description:New content for the note"`
+	CreateIfMissing bool   `json:"create_if_missing,omitempty" jsonschema:"description:Create the note if it does not exist instead of failing"`
+	ExpectedVersion string `json:"expected_version,omitempty" jsonschema:"description:Version from get_note; the update fails with a conflict if the note has changed since"`
+	Vault           string `json:"vault,omitempty" jsonschema:"description:Optional vault name, defaults to the default vault"`
+}
+
+type AppendNoteInput struct {
+	Path    string `json:"path" jsonschema:"description:Path to the note to append to"`
+	Content string `json:"content" jsonschema:"description:Content to append to the end of the note"`
+	Vault   string `json:"vault,omitempty" jsonschema:"description:Optional vault name, defaults to the default vault"`
+}
+
+type PatchNoteInput struct {
+	Path                  string `json:"path" jsonschema:"description:Path to the note to patch"`
+	Operation             string `json:"operation" jsonschema:"description:append, prepend or replace"`
+	TargetType            string `json:"target_type" jsonschema:"description:heading, block or frontmatter"`
+	Target                string `json:"target" jsonschema:"description:Heading path with :: between levels (e.g. Tasks::Today), block reference id, or frontmatter key"`
+	Content               string `json:"content" jsonschema:"description:Markdown to insert, or a JSON value for frontmatter targets"`
+	CreateTargetIfMissing bool   `json:"create_target_if_missing,omitempty" jsonschema:"description:Create the heading or frontmatter key if it does not exist"`
+	ExpectedVersion       string `json:"expected_version,omitempty" jsonschema:"description:Version from get_note; the patch fails with a conflict if the note has changed since"`
+	Vault                 string `json:"vault,omitempty" jsonschema:"description:Optional vault name, defaults to the default vault"`
+}
+
+type GetFrontmatterInput struct {
+	Path  string `json:"path" jsonschema:"description:Path to the note"`
+	Vault string `json:"vault,omitempty" jsonschema:"description:Optional vault name, defaults to the default vault"`
+}
+
+type SetFrontmatterInput struct {
+	Path            string                 `json:"path" jsonschema:"description:Path to the note"`
+	Properties      map[string]interface{} `json:"properties,omitempty" jsonschema:"description:Keys to set with their values"`
+	Mode            string                 `json:"mode,omitempty" jsonschema:"description:merge (default) keeps other keys, replace removes keys not in properties"`
+	Delete          []string               `json:"delete,omitempty" jsonschema:"description:Keys to remove"`
+	ExpectedVersion string                 `json:"expected_version,omitempty" jsonschema:"description:Version from get_note; the update fails with a conflict if the note has changed since"`
+	Vault           string                 `json:"vault,omitempty" jsonschema:"description:Optional vault name, defaults to the default vault"`
 }
 
 type DeleteNoteInput struct {
-	Path string `json:"path" jsonschema:"description:Path to the note to delete"`
+	Path  string `json:"path" jsonschema:"description:Path to the note to delete"`
+	Vault string `json:"vault,omitempty" jsonschema:"description:Optional vault name, defaults to the default vault"`
+}
+
+type ListTrashInput struct {
+	Vault string `json:"vault,omitempty" jsonschema:"description:Optional vault name, defaults to the default vault"`
+}
+
+type RestoreNoteInput struct {
+	Path  string `json:"path" jsonschema:"description:Path of the note in the trash folder, as returned by list_trash"`
+	To    string `json:"to,omitempty" jsonschema:"description:Path to restore the note to, defaults to where it was deleted from"`
+	Vault string `json:"vault,omitempty" jsonschema:"description:Optional vault name, defaults to the default vault"`
+}
+
+type EmptyTrashInput struct {
+	Vault string `json:"vault,omitempty" jsonschema:"description:Optional vault name, defaults to the default vault"`
+}
+
+type MoveNoteInput struct {
+	From   string `json:"from" jsonschema:"description:Current path of the note"`
+	To     string `json:"to" jsonschema:"description:New path for the note"`
+	DryRun bool   `json:"dry_run,omitempty" jsonschema:"description:Only report which notes would change without moving anything"`
+	Vault  string `json:"vault,omitempty" jsonschema:"description:Optional vault name, defaults to the default vault"`
 }
 
 type ListNotesInput struct {
-	Folder string `json:"folder,omitempty" jsonschema:"description:Optional folder to filter by"`
+	Folder             string `json:"folder,omitempty" jsonschema:"description:Optional folder to filter by"`
+	Recursive          bool   `json:"recursive,omitempty" jsonschema:"description:List everything below the folder instead of only its direct children"`
+	Glob               string `json:"glob,omitempty" jsonschema:"description:Only list paths relative to the folder that match this pattern; * and ? match within a name and ** across folders, e.g. **/*.pdf"`
+	IncludeAttachments bool   `json:"include_attachments,omitempty" jsonschema:"description:Also list files that are not notes, such as images and PDFs"`
+	Sort               string `json:"sort,omitempty" jsonschema:"description:Order of entries: name (default), mtime (newest first) or size (largest first)"`
+	Limit              int    `json:"limit,omitempty" jsonschema:"description:Maximum number of entries to return, 100 by default and at most 1000"`
+	Cursor             string `json:"cursor,omitempty" jsonschema:"description:next_cursor from a previous call with the same arguments, to get the next page"`
+	Vault              string `json:"vault,omitempty" jsonschema:"description:Optional vault name, defaults to the default vault"`
 }
 
 type SearchNotesInput struct {
-	Query string `json:"query" jsonschema:"description:Search query"`
+	Query             string `json:"query" jsonschema:"description:Search query: words, quoted phrases, /regex/, path:, file:, tag:, prop:key=value and modified:>YYYY-MM-DD, combined with AND, OR, NOT or - and parentheses"`
+	Limit             int    `json:"limit,omitempty" jsonschema:"description:Maximum number of notes to return, 20 by default and at most 100"`
+	Offset            int    `json:"offset,omitempty" jsonschema:"description:Number of notes to skip"`
+	Cursor            string `json:"cursor,omitempty" jsonschema:"description:next_cursor from a previous call with the same query, to get the next page"`
+	ContextLength     *int   `json:"context_length,omitempty" jsonschema:"description:Characters of context on each side of a match, 100 by default and at most 1000; 0 returns only match offsets"`
+	MaxMatchesPerFile *int   `json:"max_matches_per_file,omitempty" jsonschema:"description:Maximum matches returned per note, 3 by default and at most 100; 0 returns only paths and scores"`
+	Vault             string `json:"vault,omitempty" jsonschema:"description:Optional vault name, defaults to the default vault"`
+}
+
+type QueryVaultInput struct {
+	Query    string `json:"query" jsonschema:"description:A Dataview DQL query such as TABLE file.mtime FROM #project, or a JsonLogic expression as JSON"`
+	Language string `json:"language,omitempty" jsonschema:"description:Query language: dql or jsonlogic; by default jsonlogic if the query starts with { and dql otherwise"`
+	Vault    string `json:"vault,omitempty" jsonschema:"description:Optional vault name, defaults to the default vault"`
 }
 
 type VaultInfoInput struct {
-	// No parameters needed
+	Vault string `json:"vault,omitempty" jsonschema:"description:Optional vault name, defaults to the default vault"`
 }
 
 // Tool Output types
 
 type NoteContentOutput struct {
+	Path    string `json:"path" jsonschema:"description:Normalized path of the note"`
 	Content string `json:"content" jsonschema:"description:Content of the note"`
+	Version string `json:"version" jsonschema:"description:Content hash to pass as expected_version when updating the note"`
 }
 
 type MessageOutput struct {
 	Message string `json:"message" jsonschema:"description:Operation result message"`
 }
 
+type FrontmatterOutput struct {
+	Path        string                 `json:"path" jsonschema:"description:Normalized path of the note"`
+	Frontmatter map[string]interface{} `json:"frontmatter" jsonschema:"description:Frontmatter properties of the note"`
+	Keys        []string               `json:"keys" jsonschema:"description:Frontmatter keys in document order"`
+}
+
+type TrashListOutput struct {
+	Folder  string           `json:"folder" jsonschema:"description:Trash folder of the vault"`
+	Entries []api.TrashEntry `json:"entries" jsonschema:"description:Notes in the trash with their original path and deletion time"`
+	Count   int              `json:"count" jsonschema:"description:Number of notes in the trash"`
+}
+
+type MoveNoteOutput struct {
+	api.MoveResult
+}
+
 type NotesListOutput struct {
-	Notes string `json:"notes" jsonschema:"description:List of notes"`
+	Folder      string      `json:"folder,omitempty" jsonschema:"description:Folder that was listed"`
+	Entries     []api.Entry `json:"entries" jsonschema:"description:Folders, notes and attachments on this page with paths relative to the folder, and their size and mtime when known"`
+	Notes       []string    `json:"notes" jsonschema:"description:Paths of the notes on this page"`
+	Folders     []string    `json:"folders" jsonschema:"description:Paths of the folders on this page"`
+	Attachments []string    `json:"attachments,omitempty" jsonschema:"description:Paths of the attachments on this page"`
+	Count       int         `json:"count" jsonschema:"description:Number of entries on this page"`
+	Total       int         `json:"total" jsonschema:"description:Number of entries across all pages"`
+	Offset      int         `json:"offset" jsonschema:"description:Index of the first entry on this page"`
+	NextCursor  string      `json:"next_cursor,omitempty" jsonschema:"description:Cursor for the next page; absent on the last page"`
 }
 
 type SearchResultOutput struct {
-	Results string `json:"results" jsonschema:"description:Search results"`
+	Query      string             `json:"query" jsonschema:"description:Search query"`
+	Results    []api.SearchResult `json:"results" jsonschema:"description:Matching notes on this page with score and match context"`
+	Count      int                `json:"count" jsonschema:"description:Number of notes on this page"`
+	Total      int                `json:"total" jsonschema:"description:Number of matching notes across all pages"`
+	Offset     int                `json:"offset" jsonschema:"description:Position of the first note of this page among all matching notes"`
+	NextCursor string             `json:"next_cursor,omitempty" jsonschema:"description:Cursor for the next page, absent on the last page"`
+}
+
+type QueryVaultOutput struct {
+	Language string         `json:"language" jsonschema:"description:Language the query was run as"`
+	Rows     []api.QueryRow `json:"rows" jsonschema:"description:Notes found by the query, with the values it produced for each"`
+	Count    int            `json:"count" jsonschema:"description:Number of rows"`
 }
 
 type VaultInfoOutput struct {
-	Info string `json:"info" jsonschema:"description:Vault information"`
+	Info api.VaultInfo `json:"info" jsonschema:"description:Vault information"`
 }
 
 // Tool handlers
 
 func GetNote(ctx context.Context, req *mcp.CallToolRequest, input GetNoteInput) (*mcp.CallToolResult, NoteContentOutput, error) {
-	obsidianAPI := ctx.Value(apiKey).(*api.ObsidianAPI)
+	vault, err := vaultFromContext(ctx, input.Vault)
+	if err != nil {
+		return nil, NoteContentOutput{}, err
+	}
 
 	if err := security.ValidatePath(input.Path); err != nil {
-		return nil, NoteContentOutput{}, fmt.Errorf("invalid path: %v", err)
+		return nil, NoteContentOutput{}, err
+	}
+	if err := checkPolicy(ctx, input.Vault, security.OpRead, input.Path); err != nil {
+		return nil, NoteContentOutput{}, err
 	}
 
-	content, err := obsidianAPI.GetNote(input.Path)
+	content, err := vault.GetNote(ctx, input.Path)
 	if err != nil {
-		return nil, NoteContentOutput{}, fmt.Errorf("failed to get note: %v", err)
+		return nil, NoteContentOutput{}, fmt.Errorf("failed to get note: %w", err)
 	}
 
-	return nil, NoteContentOutput{Content: content}, nil
+	path := api.NormalizeNotePath(input.Path)
+	version := api.NoteVersion(content)
+	return textResult(formatNote(path, version, content)), NoteContentOutput{Path: path, Content: content, Version: version}, nil
 }
 
 func CreateNote(ctx context.Context, req *mcp.CallToolRequest, input CreateNoteInput) (*mcp.CallToolResult, MessageOutput, error) {
-	obsidianAPI := ctx.Value(apiKey).(*api.ObsidianAPI)
+	vault, err := vaultFromContext(ctx, input.Vault)
+	if err != nil {
+		return nil, MessageOutput{}, err
+	}
 
 	if err := security.ValidatePath(input.Path); err != nil {
-		return nil, MessageOutput{}, fmt.Errorf("invalid path: %v", err)
+		return nil, MessageOutput{}, err
+	}
+	if err := checkPolicy(ctx, input.Vault, security.OpWrite, input.Path); err != nil {
+		return nil, MessageOutput{}, err
+	}
+	defer lockNote(ctx, input.Vault, input.Path)()
+	recordAuditBefore(ctx)
+
+	if !input.Overwrite {
+		exists, err := api.NoteExists(ctx, vault, input.Path)
+		if err != nil {
+			return nil, MessageOutput{}, fmt.Errorf("failed to create note: %w", err)
+		}
+		if exists {
+			return nil, MessageOutput{}, fmt.Errorf("failed to create note: %s %w (set overwrite to replace it)", api.NormalizeNotePath(input.Path), api.ErrAlreadyExists)
+		}
 	}
 
 	sanitizedContent := security.SanitizeContent(input.Content)
-	msg, err := obsidianAPI.CreateNote(input.Path, sanitizedContent)
+	msg, err := vault.CreateNote(ctx, input.Path, sanitizedContent)
 	if err != nil {
-		return nil, MessageOutput{}, fmt.Errorf("failed to create note: %v", err)
+		return nil, MessageOutput{}, fmt.Errorf("failed to create note: %w", err)
 	}
 
 	return nil, MessageOutput{Message: msg}, nil
 }
 
 func UpdateNote(ctx context.Context, req *mcp.CallToolRequest, input UpdateNoteInput) (*mcp.CallToolResult, MessageOutput, error) {
-	obsidianAPI := ctx.Value(apiKey).(*api.ObsidianAPI)
+	vault, err := vaultFromContext(ctx, input.Vault)
+	if err != nil {
+		return nil, MessageOutput{}, err
+	}
+
+	if err := security.ValidatePath(input.Path); err != nil {
+		return nil, MessageOutput{}, err
+	}
+	if err := checkPolicy(ctx, input.Vault, security.OpWrite, input.Path); err != nil {
+		return nil, MessageOutput{}, err
+	}
+	defer lockNote(ctx, input.Vault, input.Path)()
+	recordAuditBefore(ctx)
+
+	if input.ExpectedVersion != "" {
+		current, err := vault.GetNote(ctx, input.Path)
+		if err != nil {
+			return nil, MessageOutput{}, fmt.Errorf("failed to update note: %w", err)
+		}
+		if err := api.CheckVersion(input.Path, input.ExpectedVersion, current); err != nil {
+			return nil, MessageOutput{}, fmt.Errorf("failed to update note: %w", err)
+		}
+	} else if !input.CreateIfMissing {
+		exists, err := api.NoteExists(ctx, vault, input.Path)
+		if err != nil {
+			return nil, MessageOutput{}, fmt.Errorf("failed to update note: %w", err)
+		}
+		if !exists {
+			return nil, MessageOutput{}, fmt.Errorf("failed to update note: %s %w (set create_if_missing to create it)", api.NormalizeNotePath(input.Path), api.ErrNotFound)
+		}
+	}
+
+	sanitizedContent := security.SanitizeContent(input.Content)
+	msg, err := vault.UpdateNote(ctx, input.Path, sanitizedContent)
+	if err != nil {
+		return nil, MessageOutput{}, fmt.Errorf("failed to update note: %w", err)
+	}
+
+	return nil, MessageOutput{Message: msg}, nil
+}
+
+func AppendNote(ctx context.Context, req *mcp.CallToolRequest, input AppendNoteInput) (*mcp.CallToolResult, MessageOutput, error) {
+	vault, err := vaultFromContext(ctx, input.Vault)
+	if err != nil {
+		return nil, MessageOutput{}, err
+	}
 
 	if err := security.ValidatePath(input.Path); err != nil {
-		return nil, MessageOutput{}, fmt.Errorf("invalid path: %v", err)
+		return nil, MessageOutput{}, err
+	}
+	if err := checkPolicy(ctx, input.Vault, security.OpWrite, input.Path); err != nil {
+		return nil, MessageOutput{}, err
 	}
+	defer lockNote(ctx, input.Vault, input.Path)()
+	recordAuditBefore(ctx)
 
 	sanitizedContent := security.SanitizeContent(input.Content)
-	msg, err := obsidianAPI.UpdateNote(input.Path, sanitizedContent)
+	msg, err := vault.AppendNote(ctx, input.Path, sanitizedContent)
+	if err != nil {
+		return nil, MessageOutput{}, fmt.Errorf("failed to append to note: %w", err)
+	}
+
+	return nil, MessageOutput{Message: msg}, nil
+}
+
+func PatchNote(ctx context.Context, req *mcp.CallToolRequest, input PatchNoteInput) (*mcp.CallToolResult, MessageOutput, error) {
+	vault, err := vaultFromContext(ctx, input.Vault)
+	if err != nil {
+		return nil, MessageOutput{}, err
+	}
+
+	if err := security.ValidatePath(input.Path); err != nil {
+		return nil, MessageOutput{}, err
+	}
+	if err := checkPolicy(ctx, input.Vault, security.OpWrite, input.Path); err != nil {
+		return nil, MessageOutput{}, err
+	}
+	defer lockNote(ctx, input.Vault, input.Path)()
+	recordAuditBefore(ctx)
+
+	patch := api.Patch{
+		Operation:             input.Operation,
+		TargetType:            input.TargetType,
+		Target:                input.Target,
+		Content:               security.SanitizeContent(input.Content),
+		CreateTargetIfMissing: input.CreateTargetIfMissing,
+	}
+	if err := patch.Validate(); err != nil {
+		return nil, MessageOutput{}, fmt.Errorf("invalid patch: %w", err)
+	}
+
+	if input.ExpectedVersion != "" {
+		current, err := vault.GetNote(ctx, input.Path)
+		if err != nil {
+			return nil, MessageOutput{}, fmt.Errorf("failed to patch note: %w", err)
+		}
+		if err := api.CheckVersion(input.Path, input.ExpectedVersion, current); err != nil {
+			return nil, MessageOutput{}, fmt.Errorf("failed to patch note: %w", err)
+		}
+	}
+
+	msg, err := vault.PatchNote(ctx, input.Path, patch)
 	if err != nil {
-		return nil, MessageOutput{}, fmt.Errorf("failed to update note: %v", err)
+		return nil, MessageOutput{}, fmt.Errorf("failed to patch note: %w", err)
 	}
 
 	return nil, MessageOutput{Message: msg}, nil
 }
 
+func GetFrontmatter(ctx context.Context, req *mcp.CallToolRequest, input GetFrontmatterInput) (*mcp.CallToolResult, FrontmatterOutput, error) {
+	vault, err := vaultFromContext(ctx, input.Vault)
+	if err != nil {
+		return nil, FrontmatterOutput{}, err
+	}
+
+	if err := security.ValidatePath(input.Path); err != nil {
+		return nil, FrontmatterOutput{}, err
+	}
+	if err := checkPolicy(ctx, input.Vault, security.OpRead, input.Path); err != nil {
+		return nil, FrontmatterOutput{}, err
+	}
+
+	content, err := vault.GetNote(ctx, input.Path)
+	if err != nil {
+		return nil, FrontmatterOutput{}, fmt.Errorf("failed to get note: %w", err)
+	}
+
+	values, keys, err := api.ReadFrontmatter(content)
+	if err != nil {
+		return nil, FrontmatterOutput{}, fmt.Errorf("failed to read frontmatter: %w", err)
+	}
+
+	output := FrontmatterOutput{Path: api.NormalizeNotePath(input.Path), Frontmatter: values, Keys: keys}
+	return textResult(formatFrontmatter(output.Path, values, keys)), output, nil
+}
+
+func SetFrontmatter(ctx context.Context, req *mcp.CallToolRequest, input SetFrontmatterInput) (*mcp.CallToolResult, FrontmatterOutput, error) {
+	vault, err := vaultFromContext(ctx, input.Vault)
+	if err != nil {
+		return nil, FrontmatterOutput{}, err
+	}
+
+	if err := security.ValidatePath(input.Path); err != nil {
+		return nil, FrontmatterOutput{}, err
+	}
+	if err := checkPolicy(ctx, input.Vault, security.OpWrite, input.Path); err != nil {
+		return nil, FrontmatterOutput{}, err
+	}
+	defer lockNote(ctx, input.Vault, input.Path)()
+	recordAuditBefore(ctx)
+
+	content, err := vault.GetNote(ctx, input.Path)
+	if err != nil {
+		return nil, FrontmatterOutput{}, fmt.Errorf("failed to get note: %w", err)
+	}
+	if err := api.CheckVersion(input.Path, input.ExpectedVersion, content); err != nil {
+		return nil, FrontmatterOutput{}, fmt.Errorf("failed to update frontmatter: %w", err)
+	}
+
+	updated, err := api.UpdateFrontmatter(content, api.FrontmatterUpdate{
+		Properties: input.Properties,
+		Mode:       input.Mode,
+		Delete:     input.Delete,
+	})
+	if err != nil {
+		return nil, FrontmatterOutput{}, fmt.Errorf("failed to update frontmatter: %w", err)
+	}
+
+	if updated != content {
+		if _, err := vault.UpdateNote(ctx, input.Path, security.SanitizeContent(updated)); err != nil {
+			return nil, FrontmatterOutput{}, fmt.Errorf("failed to update note: %w", err)
+		}
+	}
+
+	values, keys, err := api.ReadFrontmatter(updated)
+	if err != nil {
+		return nil, FrontmatterOutput{}, fmt.Errorf("failed to read frontmatter: %w", err)
+	}
+
+	output := FrontmatterOutput{Path: api.NormalizeNotePath(input.Path), Frontmatter: values, Keys: keys}
+	return textResult(formatFrontmatter(output.Path, values, keys)), output, nil
+}
+
 func DeleteNote(ctx context.Context, req *mcp.CallToolRequest, input DeleteNoteInput) (*mcp.CallToolResult, MessageOutput, error) {
-	obsidianAPI := ctx.Value(apiKey).(*api.ObsidianAPI)
+	vault, err := vaultFromContext(ctx, input.Vault)
+	if err != nil {
+		return nil, MessageOutput{}, err
+	}
 
 	if err := security.ValidatePath(input.Path); err != nil {
-		return nil, MessageOutput{}, fmt.Errorf("invalid path: %v", err)
+		return nil, MessageOutput{}, err
+	}
+	if err := checkPolicy(ctx, input.Vault, security.OpDelete, input.Path); err != nil {
+		return nil, MessageOutput{}, err
 	}
+	defer lockNote(ctx, input.Vault, input.Path)()
+	recordAuditBefore(ctx)
 
-	msg, err := obsidianAPI.DeleteNote(input.Path)
+	folder := ctx.Value(vaultsKey).(*vaultRegistry).trashFolder(input.Vault)
+	entry, err := api.TrashNote(ctx, vault, folder, input.Path)
 	if err != nil {
-		return nil, MessageOutput{}, fmt.Errorf("failed to delete note: %v", err)
+		return nil, MessageOutput{}, fmt.Errorf("failed to delete note: %w", err)
 	}
 
+	setAuditDestination(ctx, entry.Path)
+	msg := fmt.Sprintf("Moved note to trash: %s -> %s (use restore_note to undo)", entry.OriginalPath, entry.Path)
 	return nil, MessageOutput{Message: msg}, nil
 }
 
+func ListTrash(ctx context.Context, req *mcp.CallToolRequest, input ListTrashInput) (*mcp.CallToolResult, TrashListOutput, error) {
+	vault, err := vaultFromContext(ctx, input.Vault)
+	if err != nil {
+		return nil, TrashListOutput{}, err
+	}
+
+	folder := ctx.Value(vaultsKey).(*vaultRegistry).trashFolder(input.Vault)
+	entries, err := api.ListTrash(ctx, vault, folder)
+	if err != nil {
+		return nil, TrashListOutput{}, fmt.Errorf("failed to list trash: %w", err)
+	}
+	if policy := ctx.Value(vaultsKey).(*vaultRegistry).policy; policy != nil {
+		allowed := make([]api.TrashEntry, 0, len(entries))
+		for _, entry := range entries {
+			if policy.Allowed(security.OpRead, trashOrigin(entry)) {
+				allowed = append(allowed, entry)
+			}
+		}
+		entries = allowed
+	}
+
+	output := TrashListOutput{Folder: folder, Entries: entries, Count: len(entries)}
+	return textResult(formatTrash(folder, entries)), output, nil
+}
+
+func RestoreNote(ctx context.Context, req *mcp.CallToolRequest, input RestoreNoteInput) (*mcp.CallToolResult, MessageOutput, error) {
+	vault, err := vaultFromContext(ctx, input.Vault)
+	if err != nil {
+		return nil, MessageOutput{}, err
+	}
+
+	if err := security.ValidatePath(input.Path); err != nil {
+		return nil, MessageOutput{}, err
+	}
+	if input.To != "" {
+		if err := security.ValidatePath(input.To); err != nil {
+			return nil, MessageOutput{}, fmt.Errorf("destination: %w", err)
+		}
+	}
+
+	registry := ctx.Value(vaultsKey).(*vaultRegistry)
+	folder := registry.trashFolder(input.Vault)
+	if registry.policy != nil {
+		// Restoring reads the note and removes it from where it was deleted
+		// from, so it needs the access the note had there
+		origin, err := api.TrashOrigin(ctx, vault, folder, input.Path)
+		if err != nil {
+			return nil, MessageOutput{}, fmt.Errorf("failed to restore note: %w", err)
+		}
+		to := input.To
+		if to == "" {
+			to = origin
+		}
+		if origin == "" {
+			origin = api.NormalizeNotePath(input.Path)
+		}
+		for _, op := range []string{security.OpRead, security.OpDelete} {
+			if !registry.policy.Allowed(op, origin) {
+				return nil, MessageOutput{}, fmt.Errorf("%w: policy does not allow %s on %s", security.ErrDenied, op, api.NormalizeNotePath(input.Path))
+			}
+		}
+		if to != "" {
+			if err := checkPolicy(ctx, input.Vault, security.OpWrite, to); err != nil {
+				return nil, MessageOutput{}, err
+			}
+		}
+	}
+	recordAuditBefore(ctx)
+
+	restored, err := api.RestoreNote(ctx, vault, folder, input.Path, input.To)
+	if err != nil {
+		return nil, MessageOutput{}, fmt.Errorf("failed to restore note: %w", err)
+	}
+	setAuditDestination(ctx, restored)
+
+	return nil, MessageOutput{Message: fmt.Sprintf("Successfully restored note: %s -> %s", api.NormalizeNotePath(input.Path), restored)}, nil
+}
+
+func EmptyTrash(ctx context.Context, req *mcp.CallToolRequest, input EmptyTrashInput) (*mcp.CallToolResult, MessageOutput, error) {
+	vault, err := vaultFromContext(ctx, input.Vault)
+	if err != nil {
+		return nil, MessageOutput{}, err
+	}
+
+	registry := ctx.Value(vaultsKey).(*vaultRegistry)
+	folder := registry.trashFolder(input.Vault)
+	if registry.policy != nil {
+		// Permanently deleting a note needs delete access where it came from
+		entries, err := api.ListTrash(ctx, vault, folder)
+		if err != nil {
+			return nil, MessageOutput{}, fmt.Errorf("failed to empty trash: %w", err)
+		}
+		for _, entry := range entries {
+			if err := registry.policy.Check(security.OpDelete, trashOrigin(entry)); err != nil {
+				return nil, MessageOutput{}, fmt.Errorf("cannot empty trash holding %s: %w", entry.Path, err)
+			}
+		}
+	}
+	deleted, err := api.EmptyTrash(ctx, vault, folder)
+	purged := make([]string, len(deleted))
+	for i, entry := range deleted {
+		purged[i] = trashOrigin(entry)
+	}
+	setAuditPurged(ctx, purged)
+	if err != nil {
+		return nil, MessageOutput{}, fmt.Errorf("failed to empty trash after deleting %d notes: %w", len(deleted), err)
+	}
+
+	return nil, MessageOutput{Message: fmt.Sprintf("Permanently deleted %d notes from %s", len(deleted), folder)}, nil
+}
+
+// trashOrigin returns where a note in the trash was deleted from, or its
+// path in the trash if that is unknown
+func trashOrigin(entry api.TrashEntry) string {
+	if entry.OriginalPath != "" {
+		return entry.OriginalPath
+	}
+	return entry.Path
+}
+
+func MoveNote(ctx context.Context, req *mcp.CallToolRequest, input MoveNoteInput) (*mcp.CallToolResult, MoveNoteOutput, error) {
+	vault, err := vaultFromContext(ctx, input.Vault)
+	if err != nil {
+		return nil, MoveNoteOutput{}, err
+	}
+
+	if err := security.ValidatePath(input.From); err != nil {
+		return nil, MoveNoteOutput{}, fmt.Errorf("source: %w", err)
+	}
+	if err := security.ValidatePath(input.To); err != nil {
+		return nil, MoveNoteOutput{}, fmt.Errorf("destination: %w", err)
+	}
+
+	if err := checkPolicy(ctx, input.Vault, security.OpDelete, input.From); err != nil {
+		return nil, MoveNoteOutput{}, err
+	}
+	if err := checkPolicy(ctx, input.Vault, security.OpWrite, input.To); err != nil {
+		return nil, MoveNoteOutput{}, err
+	}
+	defer ctx.Value(vaultsKey).(*vaultRegistry).lockMoves(input.Vault)()
+	defer lockNotes(ctx, input.Vault, input.From, input.To)()
+	recordAuditBefore(ctx)
+
+	opts := api.RelocateOptions{
+		DryRun:    input.DryRun,
+		CanRead:   func(notePath string) bool { return checkPolicy(ctx, input.Vault, security.OpRead, notePath) == nil },
+		CanUpdate: func(notePath string) error { return checkPolicy(ctx, input.Vault, security.OpWrite, notePath) },
+		Lock:      func(notePath string) func() { return lockNote(ctx, input.Vault, notePath) },
+	}
+	result, err := api.RelocateNote(ctx, vault, input.From, input.To, opts)
+	if err != nil && len(result.NotUpdated) == 0 {
+		return nil, MoveNoteOutput{}, fmt.Errorf("failed to move note: %w", err)
+	}
+	if err != nil {
+		// The note was moved, so the result lists the notes left behind
+		log.Printf("Warning: %v", err)
+	}
+
+	return textResult(formatMoveResult(result)), MoveNoteOutput{result}, nil
+}
+
 func ListNotes(ctx context.Context, req *mcp.CallToolRequest, input ListNotesInput) (*mcp.CallToolResult, NotesListOutput, error) {
-	obsidianAPI := ctx.Value(apiKey).(*api.ObsidianAPI)
+	vault, err := vaultFromContext(ctx, input.Vault)
+	if err != nil {
+		return nil, NotesListOutput{}, err
+	}
 
 	if input.Folder != "" {
 		if err := security.ValidatePath(input.Folder); err != nil {
-			return nil, NotesListOutput{}, fmt.Errorf("invalid folder path: %v", err)
+			return nil, NotesListOutput{}, fmt.Errorf("folder: %w", err)
 		}
 	}
+	sortBy := strings.ToLower(input.Sort)
+	switch sortBy {
+	case "":
+		sortBy = sortByName
+	case sortByName, sortByMTime, sortBySize:
+	default:
+		return nil, NotesListOutput{}, fmt.Errorf("unknown sort %q, use %s, %s or %s", input.Sort, sortByName, sortByMTime, sortBySize)
+	}
+	var glob *regexp.Regexp
+	if input.Glob != "" {
+		if glob, err = security.CompileGlob(input.Glob); err != nil {
+			return nil, NotesListOutput{}, fmt.Errorf("glob: %w", err)
+		}
+	}
+	registry := ctx.Value(vaultsKey).(*vaultRegistry)
+	scope := fmt.Sprintf("list_notes\x00%s\x00%s\x00%t\x00%s\x00%t\x00%s",
+		registry.resolve(input.Vault), input.Folder, input.Recursive, input.Glob, input.IncludeAttachments, sortBy)
+	page, err := pageFor(scope, input.Cursor, 0, input.Limit, defaultListLimit, maxListLimit)
+	if err != nil {
+		return nil, NotesListOutput{}, err
+	}
 
-	result, err := obsidianAPI.ListNotes(input.Folder)
+	opts := api.ListOptions{
+		Recursive:   input.Recursive,
+		Attachments: input.IncludeAttachments,
+		Stats:       sortBy != sortByName,
+	}
+	entries, err := vault.ListEntries(ctx, input.Folder, opts)
 	if err != nil {
-		return nil, NotesListOutput{}, fmt.Errorf("failed to list notes: %v", err)
+		return nil, NotesListOutput{}, fmt.Errorf("failed to list notes: %w", err)
+	}
+
+	listed := make([]api.Entry, 0, len(entries))
+	for _, entry := range entries {
+		if glob != nil && !glob.MatchString(entry.Path) {
+			continue
+		}
+		// Folders are listed when they may hold notes the policy lets
+		// tools read, so Private/** hides the folder along with its notes
+		// and **/*.md doesn't hide every folder
+		entryPath := path.Join(input.Folder, entry.Path)
+		allowed := registry.policy.Allowed
+		if entry.Type == api.EntryFolder {
+			allowed = registry.policy.AllowedFolder
+		}
+		if !allowed(security.OpRead, entryPath) {
+			continue
+		}
+		listed = append(listed, entry)
+	}
+	sortEntries(listed, sortBy)
+
+	from, to := page.slice(len(listed))
+	output := NotesListOutput{
+		Folder:     input.Folder,
+		Entries:    listed[from:to],
+		Notes:      []string{},
+		Folders:    []string{},
+		Count:      to - from,
+		Total:      len(listed),
+		Offset:     page.Offset,
+		NextCursor: page.next(scope, len(listed)),
+	}
+	for _, entry := range output.Entries {
+		switch entry.Type {
+		case api.EntryNote:
+			output.Notes = append(output.Notes, entry.Path)
+		case api.EntryFolder:
+			output.Folders = append(output.Folders, entry.Path)
+		case api.EntryAttachment:
+			output.Attachments = append(output.Attachments, entry.Path)
+		}
 	}
+	return textResult(formatNotesList(output)), output, nil
+}
 
-	return nil, NotesListOutput{Notes: result}, nil
+// Orders of list_notes
+const (
+	sortByName  = "name"
+	sortByMTime = "mtime"
+	sortBySize  = "size"
+)
+
+// Limits of list_notes
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// sortEntries sorts listed entries by path ignoring case, or newest or
+// largest first with ties in path order
+func sortEntries(entries []api.Entry, sortBy string) {
+	byPath := func(a, b api.Entry) bool {
+		if la, lb := strings.ToLower(a.Path), strings.ToLower(b.Path); la != lb {
+			return la < lb
+		}
+		return a.Path < b.Path
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		switch {
+		case sortBy == sortByMTime && a.ModTime != b.ModTime:
+			return a.ModTime > b.ModTime
+		case sortBy == sortBySize && a.Size != b.Size:
+			return a.Size > b.Size
+		}
+		return byPath(a, b)
+	})
 }
 
 func SearchNotes(ctx context.Context, req *mcp.CallToolRequest, input SearchNotesInput) (*mcp.CallToolResult, SearchResultOutput, error) {
-	obsidianAPI := ctx.Value(apiKey).(*api.ObsidianAPI)
+	vault, err := vaultFromContext(ctx, input.Vault)
+	if err != nil {
+		return nil, SearchResultOutput{}, err
+	}
 
-	result, err := obsidianAPI.SearchNotes(input.Query)
+	query, err := search.ParseQuery(input.Query)
 	if err != nil {
-		return nil, SearchResultOutput{}, fmt.Errorf("failed to search notes: %v", err)
+		return nil, SearchResultOutput{}, err
+	}
+	registry := ctx.Value(vaultsKey).(*vaultRegistry)
+	scope := "search_notes\x00" + registry.resolve(input.Vault) + "\x00" + input.Query
+	page, err := pageFor(scope, input.Cursor, input.Offset, input.Limit, defaultSearchLimit, maxSearchLimit)
+	if err != nil {
+		return nil, SearchResultOutput{}, err
+	}
+	contextLength, err := searchSetting("context_length", input.ContextLength, defaultContextLength, maxContextLength)
+	if err != nil {
+		return nil, SearchResultOutput{}, err
+	}
+	maxMatches, err := searchSetting("max_matches_per_file", input.MaxMatchesPerFile, defaultMatchesPerFile, maxMatchesPerFile)
+	if err != nil {
+		return nil, SearchResultOutput{}, err
+	}
+	opts := api.SearchOptions{ContextLength: contextLength, MaxMatches: maxMatches, Offset: page.Offset, Limit: page.Limit}
+	if registry.policy != nil {
+		opts.Filter = func(notePath string) bool { return registry.policy.Allowed(security.OpRead, notePath) }
 	}
 
-	return nil, SearchResultOutput{Results: result}, nil
+	results, err := api.QueryNotes(ctx, vault, query, opts)
+	if err != nil {
+		return nil, SearchResultOutput{}, fmt.Errorf("failed to search notes: %w", err)
+	}
+
+	from, to := page.slice(len(results))
+	output := SearchResultOutput{
+		Query:      input.Query,
+		Results:    results[from:to],
+		Count:      to - from,
+		Total:      len(results),
+		Offset:     page.Offset,
+		NextCursor: page.next(scope, len(results)),
+	}
+	return textResult(formatSearchResults(output)), output, nil
+}
+
+// Limits of search_notes
+const (
+	defaultSearchLimit    = 20
+	maxSearchLimit        = 100
+	defaultContextLength  = 100
+	maxContextLength      = 1000
+	defaultMatchesPerFile = 3
+	maxMatchesPerFile     = 100
+)
+
+// searchSetting returns an optional setting of search_notes, or its
+// default if unset, capped at limit
+func searchSetting(name string, value *int, def, limit int) (int, error) {
+	if value == nil {
+		return def, nil
+	}
+	if *value < 0 {
+		return 0, fmt.Errorf("%s must not be negative", name)
+	}
+	return min(*value, limit), nil
+}
+
+// Query languages of query_vault
+const (
+	languageDQL       = "dql"
+	languageJSONLogic = "jsonlogic"
+)
+
+func QueryVault(ctx context.Context, req *mcp.CallToolRequest, input QueryVaultInput) (*mcp.CallToolResult, QueryVaultOutput, error) {
+	vault, err := vaultFromContext(ctx, input.Vault)
+	if err != nil {
+		return nil, QueryVaultOutput{}, err
+	}
+
+	// A query can read notes other than the ones it returns, as with
+	// link() or embed() in Dataview, so filtering its rows by path would
+	// not keep denied notes out of the values
+	registry := ctx.Value(vaultsKey).(*vaultRegistry)
+	if registry.policy.Restricts(security.OpRead) {
+		return nil, QueryVaultOutput{}, fmt.Errorf("%w: query_vault is disabled while the access policy limits which notes can be read", security.ErrDenied)
+	}
+
+	query := strings.TrimSpace(input.Query)
+	if query == "" {
+		return nil, QueryVaultOutput{}, fmt.Errorf("%w: empty query", search.ErrInvalidQuery)
+	}
+	language := strings.ToLower(input.Language)
+	if language == "" {
+		language = languageDQL
+		if strings.HasPrefix(query, "{") {
+			language = languageJSONLogic
+		}
+	}
+
+	runner, ok := api.Unwrap(vault).(api.QueryRunner)
+	if !ok {
+		return nil, QueryVaultOutput{}, fmt.Errorf("%w: vault %q can't run Dataview or JsonLogic queries, which need the rest backend", errors.ErrUnsupported, registry.resolve(input.Vault))
+	}
+
+	var rows []api.QueryRow
+	switch language {
+	case languageDQL:
+		rows, err = runner.QueryDataview(ctx, query)
+	case languageJSONLogic:
+		if !json.Valid([]byte(query)) {
+			return nil, QueryVaultOutput{}, fmt.Errorf("%w: a JsonLogic expression must be valid JSON", search.ErrInvalidQuery)
+		}
+		rows, err = runner.QueryJSONLogic(ctx, query)
+	default:
+		return nil, QueryVaultOutput{}, fmt.Errorf("unknown query language %q, use %s or %s", input.Language, languageDQL, languageJSONLogic)
+	}
+	if err != nil {
+		return nil, QueryVaultOutput{}, fmt.Errorf("failed to query vault: %w", err)
+	}
+
+	output := QueryVaultOutput{Language: language, Rows: rows, Count: len(rows)}
+	return textResult(formatQueryRows(rows)), output, nil
 }
 
 func GetVaultInfo(ctx context.Context, req *mcp.CallToolRequest, input VaultInfoInput) (*mcp.CallToolResult, VaultInfoOutput, error) {
-	obsidianAPI := ctx.Value(apiKey).(*api.ObsidianAPI)
+	vault, err := vaultFromContext(ctx, input.Vault)
+	if err != nil {
+		return nil, VaultInfoOutput{}, err
+	}
 
-	result, err := obsidianAPI.GetVaultInfo()
+	info, err := vault.GetVaultInfo(ctx)
 	if err != nil {
-		return nil, VaultInfoOutput{}, fmt.Errorf("failed to get vault info: %v", err)
+		return nil, VaultInfoOutput{}, fmt.Errorf("failed to get vault info: %w", err)
 	}
+	info.Name = ctx.Value(vaultsKey).(*vaultRegistry).resolve(input.Vault)
 
-	return nil, VaultInfoOutput{Info: result}, nil
+	return textResult(formatVaultInfo(info)), VaultInfoOutput{Info: info}, nil
 }
 
 func loadConfig() (Config, error) {
 	var config Config
 
 	// Default configuration
-	config.ObsidianAPI.BaseURL = "http://localhost:27123"
+	config.ObsidianAPI.BaseURL = defaultBaseURL
 	config.ObsidianAPI.Port = 27123
+	config.ObsidianAPI.Timeout = defaultRequestTimeout
+	config.ObsidianAPI.Retry = RetryConfig{
+		MaxRetries:       3,
+		BaseDelay:        250 * time.Millisecond,
+		MaxDelay:         2 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+	}
+	config.Vault.Backend = api.BackendREST
+	config.Vault.TrashFolder = api.DefaultTrashFolder
 	config.MCP.Description = "Obsidian MCP Server - Access and manage your Obsidian vault"
+	config.Server.Transport = transportStdio
+	config.Server.Address = "localhost:8080"
+	config.Server.ToolTimeout = defaultToolTimeout
+	config.Audit.MaxSize = defaultAuditMaxSize
+	config.Audit.MaxBackups = defaultAuditMaxBackups
+	config.Search.Index = true
+	config.Watch.Enabled = true
+	config.Watch.Debounce = 500 * time.Millisecond
+	config.Watch.MaxWait = 5 * time.Second
 
 	// Try to load from config file
 	configPath := "config.yaml"
@@ -216,22 +983,104 @@ func loadConfig() (Config, error) {
 	if baseURL := os.Getenv("OBSIDIAN_API_BASE_URL"); baseURL != "" {
 		config.ObsidianAPI.BaseURL = baseURL
 	}
+	if caFile := os.Getenv("OBSIDIAN_API_CA_FILE"); caFile != "" {
+		config.ObsidianAPI.TLS.CAFile = caFile
+	}
+	if fingerprint := os.Getenv("OBSIDIAN_API_CERT_FINGERPRINT"); fingerprint != "" {
+		config.ObsidianAPI.TLS.Fingerprint = fingerprint
+	}
+	if insecure := os.Getenv("OBSIDIAN_API_INSECURE_SKIP_VERIFY"); insecure != "" {
+		config.ObsidianAPI.TLS.InsecureSkipVerify = insecure == "true" || insecure == "1"
+	}
+	if backend := os.Getenv("OBSIDIAN_BACKEND"); backend != "" {
+		config.Vault.Backend = backend
+	}
+	if vaultPath := os.Getenv("OBSIDIAN_VAULT_PATH"); vaultPath != "" {
+		config.Vault.Path = vaultPath
+	}
+	if transport := os.Getenv("MCP_TRANSPORT"); transport != "" {
+		config.Server.Transport = transport
+	}
+	if address := os.Getenv("MCP_ADDRESS"); address != "" {
+		config.Server.Address = address
+	}
+	if readOnly := os.Getenv("MCP_READ_ONLY"); readOnly != "" {
+		config.Tools.ReadOnly = readOnly == "true" || readOnly == "1"
+	}
+	if auditLog := os.Getenv("MCP_AUDIT_LOG"); auditLog != "" {
+		config.Audit.Path = auditLog
+	}
+	if token := os.Getenv("MCP_AUTH_TOKEN"); token != "" {
+		config.Server.Auth.Tokens = append(config.Server.Auth.Tokens, AuthToken{
+			Name:  "env",
+			Token: token,
+			Scope: accessReadWrite,
+		})
+	}
+
+	if config.Watch.PollInterval < 0 {
+		return config, fmt.Errorf("watch.poll_interval must not be negative")
+	}
 
 	return config, nil
 }
 
+// applyFlags overrides configuration values with command line flags
+func applyFlags(config *Config) {
+	flag.StringVar(&config.Server.Transport, "transport", config.Server.Transport, "Transport to serve MCP over: stdio, http or sse")
+	flag.StringVar(&config.Server.Address, "addr", config.Server.Address, "Listen address for the http and sse transports")
+	flag.StringVar(&config.Server.TLSCert, "tls-cert", config.Server.TLSCert, "TLS certificate file for the http and sse transports")
+	flag.StringVar(&config.Server.TLSKey, "tls-key", config.Server.TLSKey, "TLS key file for the http and sse transports")
+	flag.BoolVar(&config.Tools.ReadOnly, "read-only", config.Tools.ReadOnly, "Only offer tools that don't modify the vault")
+	flag.Func("allow-tools", "Comma-separated list of the only tools to offer", func(list string) error {
+		config.Tools.Allow = toolNames(list)
+		return nil
+	})
+	flag.Func("deny-tools", "Comma-separated list of tools not to offer", func(list string) error {
+		config.Tools.Deny = toolNames(list)
+		return nil
+	})
+	flag.StringVar(&config.Audit.Path, "audit-log", config.Audit.Path, "Append a JSON Lines record of every tool call that modifies the vault to this file")
+	flag.Parse()
+}
+
 func main() {
+	if err := run(); err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+}
+
+// run starts the server and returns when it stops. Errors are returned
+// rather than fatal so deferred cleanup, such as flushing the audit log and
+// saving search indexes, still happens.
+func run() error {
 	// Load configuration
 	config, err := loadConfig()
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		return fmt.Errorf("failed to load config: %w", err)
 	}
+	applyFlags(&config)
 
-	// Create Obsidian API client
-	obsidianAPI := api.NewObsidianAPI(config.ObsidianAPI.BaseURL, config.ObsidianAPI.Token)
+	// Create vault backends
+	vaults, err := newVaultRegistry(config)
+	if err != nil {
+		return fmt.Errorf("failed to open vaults: %w", err)
+	}
+
+	// Open the audit log, if configured
+	audit, err := newAuditLog(config.Audit)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer audit.Close()
 
-	// Create context with API client
-	ctx := context.WithValue(context.Background(), apiKey, obsidianAPI)
+	// Create context with vault backends, cancelled on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx = context.WithValue(ctx, vaultsKey, vaults)
+	vaults.buildIndexes(ctx)
+	defer vaults.saveIndexes()
 
 	// Create MCP server
 	server := mcp.NewServer(
@@ -239,48 +1088,131 @@ func main() {
 			Name:    "obsidian-mcp-server",
 			Version: "1.0.2",
 		},
-		nil,
+		&mcp.ServerOptions{
+			SubscribeHandler:   subscribeNote,
+			UnsubscribeHandler: unsubscribeNote,
+		},
 	)
 
-	// Register all tools
-	mcp.AddTool(server, &mcp.Tool{
+	// Enforce token scopes on tool calls made over HTTP and bound how long
+	// tool calls and resource reads may take
+	server.AddReceivingMiddleware(withErrorCodes, requireScopes, limitDuration(config.Server.ToolTimeout))
+
+	// Register the tools enabled in the configuration
+	tools := newToolSet(server, config.Tools, audit)
+	addTool(tools, &mcp.Tool{
 		Name:        "get_note",
 		Description: "Get the content of a note by its path",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
 	}, GetNote)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(tools, &mcp.Tool{
 		Name:        "create_note",
-		Description: "Create a new note with the specified path and content",
+		Description: "Create a new note with the specified path and content; fails if the note exists unless overwrite is set",
 	}, CreateNote)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(tools, &mcp.Tool{
 		Name:        "update_note",
-		Description: "Update an existing note with new content",
+		Description: "Replace the content of an existing note; fails if the note does not exist unless create_if_missing is set",
 	}, UpdateNote)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(tools, &mcp.Tool{
+		Name:        "append_to_note",
+		Description: "Append content to the end of a note without rewriting it, creating the note if needed",
+	}, AppendNote)
+
+	addTool(tools, &mcp.Tool{
+		Name:        "patch_note",
+		Description: "Append, prepend or replace content below a heading, at a block reference, or in a frontmatter key",
+	}, PatchNote)
+
+	addTool(tools, &mcp.Tool{
+		Name:        "get_frontmatter",
+		Description: "Get the YAML frontmatter properties of a note",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, GetFrontmatter)
+
+	addTool(tools, &mcp.Tool{
+		Name:        "set_frontmatter",
+		Description: "Set, replace or delete frontmatter properties of a note, keeping the note body and key order",
+	}, SetFrontmatter)
+
+	addTool(tools, &mcp.Tool{
 		Name:        "delete_note",
-		Description: "Delete a note by its path",
+		Description: "Delete a note by moving it to the vault's trash folder, from where restore_note can bring it back",
 	}, DeleteNote)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(tools, &mcp.Tool{
+		Name:        "list_trash",
+		Description: "List deleted notes in the trash folder with their original path and deletion time",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, ListTrash)
+
+	addTool(tools, &mcp.Tool{
+		Name:        "restore_note",
+		Description: "Restore a note from the trash folder to where it was deleted from, or to another path",
+	}, RestoreNote)
+
+	addTool(tools, &mcp.Tool{
+		Name:        "empty_trash",
+		Description: "Permanently delete every note in the trash folder",
+	}, EmptyTrash)
+
+	addTool(tools, &mcp.Tool{
+		Name:        "move_note",
+		Description: "Move or rename a note and update wikilinks and markdown links pointing at it; use dry_run to preview affected notes",
+	}, MoveNote)
+
+	addTool(tools, &mcp.Tool{
 		Name:        "list_notes",
-		Description: "List all notes in the vault or in a specific folder",
+		Description: "List the notes and folders in the vault or a folder, optionally recursively, with attachments, filtered by a glob, sorted by name, mtime or size and paginated",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
 	}, ListNotes)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(tools, &mcp.Tool{
 		Name:        "search_notes",
 		Description: "Search for notes containing the specified query",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
 	}, SearchNotes)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(tools, &mcp.Tool{
+		Name:        "query_vault",
+		Description: "Run a Dataview DQL query (TABLE or LIST) or a JsonLogic expression through the Local REST API and return the matching notes with their values",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, QueryVault)
+
+	addTool(tools, &mcp.Tool{
 		Name:        "get_vault_info",
 		Description: "Get information about the vault (authentication status, version, statistics)",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
 	}, GetVaultInfo)
 
-	// Run server over stdio
-	log.Println("Starting Obsidian MCP Server with stdio transport...")
-	if err := server.Run(ctx, &mcp.StdioTransport{}); err != nil {
-		log.Fatalf("Server error: %v", err)
+	addTool(tools, &mcp.Tool{
+		Name:        "list_vaults",
+		Description: "List the configured vaults that can be passed as the vault parameter of other tools",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, ListVaults)
+
+	if err := tools.check(); err != nil {
+		return fmt.Errorf("invalid tools configuration: %w", err)
+	}
+	if config.Tools.ReadOnly {
+		log.Println("Read-only mode: tools that modify the vault are disabled")
+	}
+
+	// Expose notes as resources and tell subscribers when they change
+	resources := registerNoteResources(ctx, server, vaults)
+	if config.Watch.Enabled {
+		resources.watch(ctx, api.WatchOptions{
+			PollInterval: config.Watch.PollInterval,
+			Debounce:     config.Watch.Debounce,
+			MaxWait:      config.Watch.MaxWait,
+		})
+	}
+
+	// Run server over the configured transport
+	if err := runServer(ctx, server, config); err != nil {
+		return fmt.Errorf("server error: %w", err)
 	}
+	return nil
 }
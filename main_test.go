@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"obsidian-mcp/api"
+	"obsidian-mcp/security"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestQueryVaultReadPolicy(t *testing.T) {
+	vault, err := api.NewObsidianAPI("http://127.0.0.1:1", "token", api.ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		config   security.PolicyConfig
+		wantCode string
+	}{
+		{security.PolicyConfig{PolicyRules: security.PolicyRules{Deny: []string{"Private/**"}}}, codeForbidden},
+		{security.PolicyConfig{Read: security.PolicyRules{Allow: []string{"Public/**"}}}, codeForbidden},
+		// Rules for other operations don't stop queries, which then fail to
+		// reach Obsidian
+		{security.PolicyConfig{Write: security.PolicyRules{Allow: []string{"Inbox/**"}}}, codeUnavailable},
+	}
+
+	for _, tt := range tests {
+		policy, err := security.NewPolicy(tt.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		registry := &vaultRegistry{
+			configs:      []VaultConfig{{Name: "default"}},
+			backends:     map[string]api.VaultBackend{"default": vault},
+			defaultVault: "default",
+			policy:       policy,
+		}
+		ctx := context.WithValue(context.Background(), vaultsKey, registry)
+
+		_, _, err = QueryVault(ctx, nil, QueryVaultInput{Query: "LIST FROM #project"})
+		if code := errorCode(err); code != tt.wantCode {
+			t.Errorf("QueryVault() with %+v: error code %q (%v), want %q", tt.config, code, err, tt.wantCode)
+		}
+	}
+}
+
+func TestTrashPolicy(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"Private/secret.md", "Public/open.md"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, name), []byte("---\ntag: x\n---\ntext"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vault, err := api.NewFileSystemVault(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := security.NewPolicy(security.PolicyConfig{PolicyRules: security.PolicyRules{Deny: []string{"Private/**"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := &vaultRegistry{
+		configs:      []VaultConfig{{Name: "default"}},
+		backends:     map[string]api.VaultBackend{"default": vault},
+		defaultVault: "default",
+		policy:       policy,
+	}
+	ctx := context.WithValue(context.Background(), vaultsKey, registry)
+
+	// Trashed past the policy, as if the rule was added afterwards
+	for _, name := range []string{"Private/secret.md", "Public/open.md"} {
+		if _, err := api.TrashNote(ctx, vault, api.DefaultTrashFolder, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	readResource := func(notePath string) error {
+		req := &mcp.ReadResourceRequest{Params: &mcp.ReadResourceParams{URI: noteURI("default", notePath)}}
+		_, err := ReadNoteResource(ctx, req)
+		return err
+	}
+	tests := []struct {
+		name     string
+		call     func() error
+		wantCode string
+	}{
+		{"get_note", func() error {
+			_, _, err := GetNote(ctx, nil, GetNoteInput{Path: ".trash/secret.md"})
+			return err
+		}, codeForbidden},
+		{"get_frontmatter", func() error {
+			_, _, err := GetFrontmatter(ctx, nil, GetFrontmatterInput{Path: ".trash/secret.md"})
+			return err
+		}, codeForbidden},
+		{"resource", func() error { return readResource(".trash/secret.md") }, codeForbidden},
+		{"restore elsewhere", func() error {
+			_, _, err := RestoreNote(ctx, nil, RestoreNoteInput{Path: ".trash/secret.md", To: "Public/copy.md"})
+			return err
+		}, codeForbidden},
+		{"get_note allowed", func() error {
+			_, _, err := GetNote(ctx, nil, GetNoteInput{Path: ".trash/open.md"})
+			return err
+		}, ""},
+		{"restore allowed", func() error {
+			_, _, err := RestoreNote(ctx, nil, RestoreNoteInput{Path: ".trash/open.md", To: "Public/copy.md"})
+			return err
+		}, ""},
+	}
+	for _, tt := range tests {
+		err := tt.call()
+		if err == nil {
+			if tt.wantCode != "" {
+				t.Errorf("%s: no error, want %q", tt.name, tt.wantCode)
+			}
+			continue
+		}
+		if code := errorCode(err); code != tt.wantCode {
+			t.Errorf("%s: error code %q (%v), want %q", tt.name, code, err, tt.wantCode)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "Public/copy.md")); err != nil {
+		t.Errorf("allowed restore: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, ".trash/secret.md")); err != nil {
+		t.Errorf("denied restore moved the note: %v", err)
+	}
+}
+
+func TestSortEntries(t *testing.T) {
+	entries := []api.Entry{
+		{Path: "b.md", Size: 10, ModTime: 300},
+		{Path: "A.md", Size: 30, ModTime: 100},
+		{Path: "a.md", Size: 10, ModTime: 300},
+		{Path: "c.md", Size: 20, ModTime: 200},
+	}
+
+	tests := []struct {
+		sortBy string
+		want   []string
+	}{
+		{sortByName, []string{"A.md", "a.md", "b.md", "c.md"}},
+		{sortByMTime, []string{"a.md", "b.md", "c.md", "A.md"}},
+		{sortBySize, []string{"A.md", "c.md", "a.md", "b.md"}},
+	}
+
+	for _, tt := range tests {
+		sorted := slices.Clone(entries)
+		sortEntries(sorted, tt.sortBy)
+		var got []string
+		for _, entry := range sorted {
+			got = append(got, entry.Path)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("sortEntries(%s) = %v, want %v", tt.sortBy, got, tt.want)
+		}
+	}
+}
+
+func TestListNotesFilters(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.md", "pic.png", "Private/secret.md", "Projects/b.md", "Projects/doc.pdf"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, name), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vault, err := api.NewFileSystemVault(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := security.NewPolicy(security.PolicyConfig{Read: security.PolicyRules{Deny: []string{"Private/**", "**/*.pdf"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := &vaultRegistry{
+		configs:      []VaultConfig{{Name: "default"}},
+		backends:     map[string]api.VaultBackend{"default": vault},
+		defaultVault: "default",
+		policy:       policy,
+	}
+	ctx := context.WithValue(context.Background(), vaultsKey, registry)
+
+	tests := []struct {
+		input ListNotesInput
+		want  []string
+	}{
+		{ListNotesInput{}, []string{"a.md", "Projects"}},
+		{ListNotesInput{Recursive: true, IncludeAttachments: true}, []string{"a.md", "pic.png", "Projects", "Projects/b.md"}},
+		{ListNotesInput{Recursive: true, IncludeAttachments: true, Glob: "**/*.md"}, []string{"a.md", "Projects/b.md"}},
+		{ListNotesInput{Folder: "Projects", IncludeAttachments: true, Glob: "*.pdf"}, nil},
+		{ListNotesInput{Folder: "Projects", Glob: "B.*"}, []string{"b.md"}},
+		{ListNotesInput{Folder: "Private"}, nil},
+	}
+
+	for _, tt := range tests {
+		_, output, err := ListNotes(ctx, nil, tt.input)
+		if err != nil {
+			t.Errorf("ListNotes(%+v): %v", tt.input, err)
+			continue
+		}
+		var got []string
+		for _, entry := range output.Entries {
+			got = append(got, entry.Path)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ListNotes(%+v) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// errInvalidCursor is returned for cursors that were not issued for the
+// request they are passed with
+var errInvalidCursor = errors.New("invalid cursor")
+
+// page is the range of results a paginated tool call returns
+type page struct {
+	Offset int
+	Limit  int
+}
+
+// pageFor works out the page a tool call asks for. A cursor takes
+// precedence over an offset; limit defaults to defaultLimit and can't
+// exceed maxLimit. scope identifies the request, such as the vault and
+// query, so cursors can't be used with another one.
+func pageFor(scope, cursor string, offset, limit, defaultLimit, maxLimit int) (page, error) {
+	if limit < 0 {
+		return page{}, fmt.Errorf("limit must not be negative")
+	}
+	if offset < 0 {
+		return page{}, fmt.Errorf("offset must not be negative")
+	}
+	if limit == 0 {
+		limit = defaultLimit
+	}
+	if cursor != "" {
+		var err error
+		if offset, err = decodeCursor(scope, cursor); err != nil {
+			return page{}, err
+		}
+	}
+	return page{Offset: offset, Limit: min(limit, maxLimit)}, nil
+}
+
+// slice returns the part of n results that falls in the page
+func (p page) slice(n int) (from, to int) {
+	from = min(p.Offset, n)
+	return from, from + min(p.Limit, n-from)
+}
+
+// next returns the cursor of the page after this one, or an empty string
+// if there are no more than total results
+func (p page) next(scope string, total int) string {
+	if p.Offset >= total || p.Limit >= total-p.Offset {
+		return ""
+	}
+	return encodeCursor(scope, p.Offset+p.Limit)
+}
+
+// encodeCursor returns an opaque cursor for the results of a request
+// starting at offset
+func encodeCursor(scope string, offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset) + ":" + scopeHash(scope)))
+}
+
+// decodeCursor returns the offset recorded in a cursor, checking that it
+// was issued for the same request
+func decodeCursor(scope, cursor string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, fmt.Errorf("%w: not a cursor returned by this server", errInvalidCursor)
+	}
+	offsetText, hash, ok := strings.Cut(string(data), ":")
+	offset, err := strconv.Atoi(offsetText)
+	if !ok || err != nil || offset < 0 {
+		return 0, fmt.Errorf("%w: not a cursor returned by this server", errInvalidCursor)
+	}
+	if hash != scopeHash(scope) {
+		return 0, fmt.Errorf("%w: the cursor belongs to a different request; repeat the same arguments with the cursor", errInvalidCursor)
+	}
+	return offset, nil
+}
+
+func scopeHash(scope string) string {
+	sum := sha256.Sum256([]byte(scope))
+	return hex.EncodeToString(sum[:6])
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, offset := range []int{0, 1, 20, 100000} {
+		cursor := encodeCursor("search_notes\x00default\x00garden", offset)
+		got, err := decodeCursor("search_notes\x00default\x00garden", cursor)
+		if err != nil || got != offset {
+			t.Errorf("decodeCursor(encodeCursor(%d)) = %d, %v", offset, got, err)
+		}
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	const scope = "search_notes\x00default\x00garden"
+	encode := func(text string) string { return base64.RawURLEncoding.EncodeToString([]byte(text)) }
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"other query", encodeCursor("search_notes\x00default\x00roses", 20)},
+		{"other vault", encodeCursor("search_notes\x00work\x00garden", 20)},
+		{"other tool", encodeCursor("list_notes\x00default\x00garden", 20)},
+		{"not base64", "not a cursor!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte("20:x"))},
+		{"no separator", encode("20")},
+		{"offset not a number", encode("x:" + scopeHash(scope))},
+		{"negative offset", encode("-20:" + scopeHash(scope))},
+		{"truncated hash", encode("20:" + scopeHash(scope)[:4])},
+	}
+
+	for _, tt := range tests {
+		if _, err := decodeCursor(scope, tt.cursor); !errors.Is(err, errInvalidCursor) {
+			t.Errorf("%s: decodeCursor() error = %v, want errInvalidCursor", tt.name, err)
+		}
+	}
+}
+
+func TestPageFor(t *testing.T) {
+	const scope = "list_notes\x00default\x00"
+
+	tests := []struct {
+		name          string
+		cursor        string
+		offset, limit int
+		want          page
+		wantErr       bool
+	}{
+		{name: "defaults", want: page{Offset: 0, Limit: 20}},
+		{name: "offset and limit", offset: 40, limit: 10, want: page{Offset: 40, Limit: 10}},
+		{name: "limit clamped", limit: 5000, want: page{Offset: 0, Limit: 100}},
+		{name: "limit at maximum", limit: 100, want: page{Offset: 0, Limit: 100}},
+		{name: "cursor wins over offset", cursor: encodeCursor(scope, 60), offset: 5, want: page{Offset: 60, Limit: 20}},
+		{name: "cursor with limit", cursor: encodeCursor(scope, 60), limit: 500, want: page{Offset: 60, Limit: 100}},
+		{name: "cursor of another scope", cursor: encodeCursor("list_notes\x00default\x00Inbox", 60), wantErr: true},
+		{name: "negative limit", limit: -1, wantErr: true},
+		{name: "negative offset", offset: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := pageFor(scope, tt.cursor, tt.offset, tt.limit, 20, 100)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: pageFor() error = %v, want error %t", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil && tt.cursor != "" && !errors.Is(err, errInvalidCursor) {
+			t.Errorf("%s: pageFor() error = %v, want errInvalidCursor", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: pageFor() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPageSliceAndNext(t *testing.T) {
+	const scope = "search_notes\x00default\x00garden"
+
+	tests := []struct {
+		page           page
+		total          int
+		wantFrom, want int
+		wantNext       bool
+	}{
+		{page: page{Offset: 0, Limit: 20}, total: 50, wantFrom: 0, want: 20, wantNext: true},
+		{page: page{Offset: 40, Limit: 20}, total: 50, wantFrom: 40, want: 50},
+		{page: page{Offset: 30, Limit: 20}, total: 50, wantFrom: 30, want: 50},
+		{page: page{Offset: 80, Limit: 20}, total: 50, wantFrom: 50, want: 50},
+		{page: page{Offset: 0, Limit: 20}, total: 0, wantFrom: 0, want: 0},
+		// An offset from a cursor must not overflow
+		{page: page{Offset: math.MaxInt - 5, Limit: 20}, total: 50, wantFrom: 50, want: 50},
+	}
+
+	for _, tt := range tests {
+		from, to := tt.page.slice(tt.total)
+		if from != tt.wantFrom || to != tt.want {
+			t.Errorf("%+v.slice(%d) = %d, %d; want %d, %d", tt.page, tt.total, from, to, tt.wantFrom, tt.want)
+		}
+		next := tt.page.next(scope, tt.total)
+		if (next != "") != tt.wantNext {
+			t.Errorf("%+v.next(%d) = %q, want a cursor: %t", tt.page, tt.total, next, tt.wantNext)
+		}
+		if next == "" {
+			continue
+		}
+		following, err := pageFor(scope, next, 0, tt.page.Limit, 20, 100)
+		if err != nil || following.Offset != tt.page.Offset+tt.page.Limit {
+			t.Errorf("%+v.next(%d) leads to %+v, %v", tt.page, tt.total, following, err)
+		}
+	}
+}
+
+func TestSearchSetting(t *testing.T) {
+	value := func(n int) *int { return &n }
+
+	tests := []struct {
+		value   *int
+		want    int
+		wantErr bool
+	}{
+		{value: nil, want: 100},
+		{value: value(0), want: 0},
+		{value: value(250), want: 250},
+		{value: value(5000), want: 1000},
+		{value: value(-1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := searchSetting("context_length", tt.value, 100, 1000)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("searchSetting(%v) = %d, %v; want %d, error %t", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"obsidian-mcp/api"
+	"obsidian-mcp/security"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	// noteScheme is the URI scheme of note resources
+	noteScheme = "obsidian"
+	// noteURITemplate addresses a note by vault name and path
+	noteURITemplate = noteScheme + "://{vault}/{+path}"
+	// markdownMIMEType is the MIME type of note resources
+	markdownMIMEType = "text/markdown"
+)
+
+// noteURI returns the resource URI of a note in a vault
+func noteURI(vault, notePath string) string {
+	segments := strings.Split(notePath, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return noteScheme + "://" + url.PathEscape(vault) + "/" + strings.Join(segments, "/")
+}
+
+// parseNoteURI returns the vault name and note path addressed by a note
+// resource URI
+func parseNoteURI(uri string) (vault, notePath string, err error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", "", err
+	}
+	notePath = strings.TrimPrefix(u.Path, "/")
+	if u.Scheme != noteScheme || u.Host == "" || notePath == "" {
+		return "", "", fmt.Errorf("not a note URI: %s", uri)
+	}
+	return u.Host, notePath, nil
+}
+
+// ReadNoteResource reads a note addressed by an obsidian:// URI
+func ReadNoteResource(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	uri := req.Params.URI
+	vaultName, notePath, err := parseNoteURI(uri)
+	if err != nil {
+		return nil, mcp.ResourceNotFoundError(uri)
+	}
+
+	if err := security.ValidatePath(notePath); err != nil {
+		return nil, err
+	}
+	vault, err := vaultFromContext(ctx, vaultName)
+	if err != nil {
+		return nil, mcp.ResourceNotFoundError(uri)
+	}
+	if err := checkPolicy(ctx, vaultName, security.OpRead, notePath); err != nil {
+		return nil, err
+	}
+
+	content, err := vault.GetNote(ctx, notePath)
+	if errors.Is(err, api.ErrNotFound) {
+		return nil, mcp.ResourceNotFoundError(uri)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get note: %w", err)
+	}
+
+	return &mcp.ReadResourceResult{
+		Contents: []*mcp.ResourceContents{{URI: uri, MIMEType: markdownMIMEType, Text: content}},
+	}, nil
+}
+
+// noteResources keeps the server's resource list in sync with the notes
+// of every vault
+type noteResources struct {
+	server *mcp.Server
+	vaults *vaultRegistry
+
+	mu sync.Mutex
+	// uris holds the registered resource URIs of each vault
+	uris map[string]map[string]bool
+}
+
+// registerNoteResources adds the note resource template and lists the
+// notes of every vault as resources. Vaults that cannot be listed are
+// logged and skipped; their notes can still be read through the template.
+func registerNoteResources(ctx context.Context, server *mcp.Server, vaults *vaultRegistry) *noteResources {
+	server.AddResourceTemplate(&mcp.ResourceTemplate{
+		Name:        "note",
+		Title:       "Obsidian note",
+		Description: "A markdown note, addressed by vault name and path within the vault",
+		MIMEType:    markdownMIMEType,
+		URITemplate: noteURITemplate,
+	}, ReadNoteResource)
+
+	resources := &noteResources{
+		server: server,
+		vaults: vaults,
+		uris:   make(map[string]map[string]bool),
+	}
+	for _, name := range vaults.names() {
+		if err := resources.sync(ctx, name); err != nil {
+			log.Printf("Warning: could not list notes of vault %q as resources: %v", name, err)
+		}
+	}
+	return resources
+}
+
+// sync lists the notes of a vault and adds or removes resources so the
+// resource list matches them
+func (r *noteResources) sync(ctx context.Context, vaultName string) error {
+	vault, err := r.vaults.get(vaultName)
+	if err != nil {
+		return err
+	}
+	notes, err := vault.ListAllNotes(ctx)
+	if err != nil {
+		return err
+	}
+	notes = allowedNotes(r.vaults.policy, "", notes)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := make(map[string]bool, len(notes))
+	for _, note := range notes {
+		uri := noteURI(vaultName, note)
+		current[uri] = true
+		if !r.uris[vaultName][uri] {
+			r.addResource(uri, note)
+		}
+	}
+
+	var removed []string
+	for uri := range r.uris[vaultName] {
+		if !current[uri] {
+			removed = append(removed, uri)
+		}
+	}
+	if len(removed) > 0 {
+		r.server.RemoveResources(removed...)
+	}
+
+	r.uris[vaultName] = current
+	return nil
+}
+
+// addResource registers a note as a resource
+func (r *noteResources) addResource(uri, note string) {
+	r.server.AddResource(&mcp.Resource{
+		URI:      uri,
+		Name:     note,
+		Title:    strings.TrimSuffix(path.Base(note), path.Ext(note)),
+		MIMEType: markdownMIMEType,
+	}, ReadNoteResource)
+}
+
+// apply updates the resource list of a vault for created and deleted notes
+// and notifies sessions subscribed to any of the changed notes. Changes to
+// notes the access policy does not allow reading are ignored.
+func (r *noteResources) apply(ctx context.Context, vaultName string, changes []api.NoteChange) {
+	if r.vaults.policy != nil {
+		allowed := make([]api.NoteChange, 0, len(changes))
+		for _, change := range changes {
+			if r.vaults.policy.Allowed(security.OpRead, change.Path) {
+				allowed = append(allowed, change)
+			}
+		}
+		changes = allowed
+	}
+
+	r.mu.Lock()
+	if r.uris[vaultName] == nil {
+		r.uris[vaultName] = make(map[string]bool)
+	}
+	var removed []string
+	for _, change := range changes {
+		uri := noteURI(vaultName, change.Path)
+		switch {
+		case change.Kind == api.NoteDeleted && r.uris[vaultName][uri]:
+			delete(r.uris[vaultName], uri)
+			removed = append(removed, uri)
+		case change.Kind != api.NoteDeleted && !r.uris[vaultName][uri]:
+			r.uris[vaultName][uri] = true
+			r.addResource(uri, change.Path)
+		}
+	}
+	if len(removed) > 0 {
+		r.server.RemoveResources(removed...)
+	}
+	r.mu.Unlock()
+
+	for _, change := range changes {
+		params := &mcp.ResourceUpdatedNotificationParams{URI: noteURI(vaultName, change.Path)}
+		if err := r.server.ResourceUpdated(ctx, params); err != nil {
+			log.Printf("Warning: failed to notify subscribers of %s: %v", params.URI, err)
+		}
+	}
+}
+
+// watch follows changes to the notes of every vault whose backend can
+// report them, until ctx is done
+func (r *noteResources) watch(ctx context.Context, opts api.WatchOptions) {
+	for _, name := range r.vaults.names() {
+		backend, err := r.vaults.get(name)
+		if err != nil {
+			continue
+		}
+		watcher, ok := backend.(api.Watcher)
+		if !ok {
+			continue
+		}
+		go func() {
+			err := watcher.Watch(ctx, opts, func(changes []api.NoteChange) {
+				r.apply(ctx, name, changes)
+			})
+			if err != nil {
+				log.Printf("Warning: stopped watching vault %q: %v", name, err)
+			}
+		}()
+	}
+}
+
+// subscribeNote accepts subscriptions to note resources. Updates are sent
+// by the vault watcher.
+func subscribeNote(ctx context.Context, req *mcp.SubscribeRequest) error {
+	_, _, err := parseNoteURI(req.Params.URI)
+	return err
+}
+
+// unsubscribeNote accepts unsubscribing from note resources
+func unsubscribeNote(ctx context.Context, req *mcp.UnsubscribeRequest) error {
+	return nil
+}
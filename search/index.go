@@ -0,0 +1,377 @@
+package search
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// indexFormat is the version of the saved index format. Saved indexes of
+// another version are not loaded.
+const indexFormat = 1
+
+// ErrIndexFormat is returned when loading an index saved in another format
+var ErrIndexFormat = errors.New("unsupported index format")
+
+// Hit is a document matching a query, with its BM25 score
+type Hit struct {
+	Path  string
+	Score float64
+}
+
+// Index is an inverted index of documents, ranked with BM25. Each document
+// carries a stamp, such as its modification time, so callers can tell
+// which documents changed since they were indexed. It is safe for
+// concurrent use.
+type Index struct {
+	mu sync.RWMutex
+	// docs is indexed by document id; removed documents keep their id with
+	// an empty path until the index is compacted
+	docs     []document
+	ids      map[string]int32
+	postings map[string][]posting
+	live     int
+	totalLen int64
+	dirty    bool
+}
+
+// document is an indexed document. Fields are exported for gob.
+type document struct {
+	Path   string
+	Length int32 // number of terms
+	Stamp  int64
+}
+
+// posting records how often a term occurs in a document
+type posting struct {
+	Doc  int32
+	Freq int32
+}
+
+// savedIndex is the on-disk form of an Index
+type savedIndex struct {
+	Format   int
+	Docs     []document
+	Postings map[string][]posting
+}
+
+// NewIndex returns an empty index
+func NewIndex() *Index {
+	return &Index{ids: make(map[string]int32), postings: make(map[string][]posting)}
+}
+
+// Add indexes the content of a document, replacing an earlier version
+func (x *Index) Add(path, content string, stamp int64) {
+	counts := make(map[string]int32)
+	var length int32
+	for _, token := range Tokenize(content) {
+		counts[token.Term]++
+		length++
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.remove(path)
+	id := int32(len(x.docs))
+	x.docs = append(x.docs, document{Path: path, Length: length, Stamp: stamp})
+	x.ids[path] = id
+	for term, freq := range counts {
+		x.postings[term] = append(x.postings[term], posting{Doc: id, Freq: freq})
+	}
+	x.live++
+	x.totalLen += int64(length)
+	x.dirty = true
+	x.compactIfSparse()
+}
+
+// Remove drops a document from the index
+func (x *Index) Remove(path string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(path)
+	x.compactIfSparse()
+}
+
+func (x *Index) remove(path string) {
+	id, ok := x.ids[path]
+	if !ok {
+		return
+	}
+	delete(x.ids, path)
+	x.totalLen -= int64(x.docs[id].Length)
+	x.docs[id] = document{}
+	x.live--
+	x.dirty = true
+}
+
+// compactIfSparse compacts the index once removed documents outnumber
+// the indexed ones
+func (x *Index) compactIfSparse() {
+	if len(x.docs) > 1000 && x.live < len(x.docs)/2 {
+		x.compact()
+	}
+}
+
+// compact drops removed documents from the postings and renumbers the rest
+func (x *Index) compact() {
+	renumbered := make([]int32, len(x.docs))
+	docs := make([]document, 0, x.live)
+	for id, doc := range x.docs {
+		renumbered[id] = -1
+		if doc.Path != "" {
+			renumbered[id] = int32(len(docs))
+			x.ids[doc.Path] = int32(len(docs))
+			docs = append(docs, doc)
+		}
+	}
+	x.docs = docs
+
+	for term, list := range x.postings {
+		kept := list[:0]
+		for _, p := range list {
+			if id := renumbered[p.Doc]; id >= 0 {
+				kept = append(kept, posting{Doc: id, Freq: p.Freq})
+			}
+		}
+		if len(kept) == 0 {
+			delete(x.postings, term)
+		} else {
+			x.postings[term] = kept
+		}
+	}
+}
+
+// Stamps returns the stamp of every indexed document by path
+func (x *Index) Stamps() map[string]int64 {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	stamps := make(map[string]int64, x.live)
+	for path, id := range x.ids {
+		stamps[path] = x.docs[id].Stamp
+	}
+	return stamps
+}
+
+// Len returns the number of indexed documents
+func (x *Index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.live
+}
+
+// Search returns the documents containing any of the terms, best match
+// first. Terms must come from Tokenize or Terms.
+func (x *Index) Search(terms []string) []Hit {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if x.live == 0 {
+		return nil
+	}
+
+	avgLen := float64(x.totalLen) / float64(x.live)
+	scores := make(map[int32]float64)
+	for _, term := range terms {
+		list := x.postings[term]
+		matching := 0
+		for _, p := range list {
+			if x.docs[p.Doc].Path != "" {
+				matching++
+			}
+		}
+		if matching == 0 {
+			continue
+		}
+
+		idf := math.Log(1 + (float64(x.live)-float64(matching)+0.5)/(float64(matching)+0.5))
+		for _, p := range list {
+			doc := x.docs[p.Doc]
+			if doc.Path == "" {
+				continue
+			}
+			freq := float64(p.Freq)
+			norm := bm25K1 * (1 - bm25B + bm25B*float64(doc.Length)/avgLen)
+			scores[p.Doc] += idf * freq * (bm25K1 + 1) / (freq + norm)
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{Path: x.docs[id].Path, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Path < hits[j].Path
+	})
+	return hits
+}
+
+// Candidates returns the documents that may match a query, judged by the
+// words and phrases it requires. ok is false when the index can't narrow
+// the query down, as for a query of only fields, and every document must
+// be checked.
+func (x *Index) Candidates(q *Query) (paths []string, ok bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	ids, ok := x.candidates(q.Root)
+	if !ok {
+		return nil, false
+	}
+	paths = make([]string, 0, len(ids))
+	for id := range ids {
+		if path := x.docs[id].Path; path != "" {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths, true
+}
+
+// candidates returns a superset of the documents matching a node, or false
+// when any document may match
+func (x *Index) candidates(node Node) (map[int32]bool, bool) {
+	switch n := node.(type) {
+	case *Word:
+		if n.text != nil {
+			return nil, false
+		}
+		return x.containingAll(n.terms), true
+	case *Phrase:
+		terms := Terms(n.Text)
+		if len(terms) == 0 {
+			return nil, false
+		}
+		return x.containingAll(terms), true
+	case *And:
+		var ids map[int32]bool
+		for _, child := range n.Nodes {
+			childIDs, ok := x.candidates(child)
+			if !ok {
+				continue
+			}
+			if ids == nil {
+				ids = childIDs
+				continue
+			}
+			for id := range ids {
+				if !childIDs[id] {
+					delete(ids, id)
+				}
+			}
+		}
+		return ids, ids != nil
+	case *Or:
+		ids := make(map[int32]bool)
+		for _, child := range n.Nodes {
+			childIDs, ok := x.candidates(child)
+			if !ok {
+				return nil, false
+			}
+			for id := range childIDs {
+				ids[id] = true
+			}
+		}
+		return ids, true
+	}
+	return nil, false
+}
+
+// containingAll returns the documents containing every one of the terms
+func (x *Index) containingAll(terms []string) map[int32]bool {
+	var ids map[int32]bool
+	for _, term := range terms {
+		next := make(map[int32]bool)
+		for _, p := range x.postings[term] {
+			if ids == nil || ids[p.Doc] {
+				next[p.Doc] = true
+			}
+		}
+		ids = next
+	}
+	return ids
+}
+
+// Save writes the index to a file if it changed since it was loaded or
+// last saved. The file is replaced atomically.
+func (x *Index) Save(file string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.dirty {
+		return nil
+	}
+	x.compact()
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	saved := savedIndex{Format: indexFormat, Docs: x.docs, Postings: x.postings}
+	if err := gob.NewEncoder(tmp).Encode(saved); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return err
+	}
+	x.dirty = false
+	return nil
+}
+
+// LoadIndex reads an index saved with Save
+func LoadIndex(file string) (*Index, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var saved savedIndex
+	if err := gob.NewDecoder(f).Decode(&saved); err != nil {
+		return nil, fmt.Errorf("invalid index file: %v", err)
+	}
+	if saved.Format != indexFormat {
+		return nil, fmt.Errorf("%w %d", ErrIndexFormat, saved.Format)
+	}
+
+	x := &Index{docs: saved.Docs, ids: make(map[string]int32, len(saved.Docs)), postings: saved.Postings}
+	if x.postings == nil {
+		x.postings = make(map[string][]posting)
+	}
+	for id, doc := range x.docs {
+		if doc.Path == "" {
+			continue
+		}
+		x.ids[doc.Path] = int32(id)
+		x.live++
+		x.totalLen += int64(doc.Length)
+	}
+	for term, list := range x.postings {
+		for _, p := range list {
+			if p.Doc < 0 || int(p.Doc) >= len(x.docs) {
+				return nil, fmt.Errorf("invalid index file: bad posting for %q", term)
+			}
+		}
+	}
+	return x, nil
+}
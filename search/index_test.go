@@ -0,0 +1,153 @@
+package search
+
+import (
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// hitPaths returns the paths of hits in order
+func hitPaths(hits []Hit) []string {
+	paths := make([]string, len(hits))
+	for i, hit := range hits {
+		paths[i] = hit.Path
+	}
+	return paths
+}
+
+func TestIndexSearch(t *testing.T) {
+	x := NewIndex()
+	x.Add("once.md", "garden notes about roses and other plants in spring", 1)
+	x.Add("twice.md", "garden garden notes about roses and other plants in spring", 1)
+	x.Add("short.md", "garden roses", 1)
+	x.Add("other.md", "kitchen recipes", 1)
+	x.Add("removed.md", "garden garden garden", 1)
+	x.Remove("removed.md")
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// More occurrences rank higher, and a shorter note beats a longer
+		// one with the same count
+		{"garden", []string{"short.md", "twice.md", "once.md"}},
+		// Notes matching more terms rank higher; stems match
+		{"gardening recipe", []string{"other.md", "short.md", "twice.md", "once.md"}},
+		{"spring", []string{"once.md", "twice.md"}},
+		{"missing", []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := hitPaths(x.Search(Terms(tt.query))); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// A term in fewer notes weighs more
+	hits := x.Search(Terms("roses kitchen"))
+	if len(hits) != 4 || hits[0].Path != "other.md" {
+		t.Errorf("Search(roses kitchen) = %v, want other.md first", hits)
+	}
+	if x.Len() != 4 {
+		t.Errorf("Len() = %d, want 4", x.Len())
+	}
+}
+
+func TestIndexSaveLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "index", "vault.gob")
+
+	x := NewIndex()
+	x.Add("a.md", "apples and pears", 10)
+	x.Add("b.md", "pears only", 20)
+	x.Add("c.md", "cherries", 30)
+	if err := x.Save(file); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadIndex(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int64{"a.md": 10, "b.md": 20, "c.md": 30}; !reflect.DeepEqual(loaded.Stamps(), want) {
+		t.Errorf("Stamps() = %v, want %v", loaded.Stamps(), want)
+	}
+	if got, want := loaded.Search(Terms("pears")), x.Search(Terms("pears")); !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded Search() = %v, want %v", got, want)
+	}
+
+	// Update the loaded index incrementally and save it again
+	loaded.Add("b.md", "plums now", 21)
+	loaded.Remove("c.md")
+	loaded.Add("d.md", "pears and plums", 40)
+	if err := loaded.Save(file); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := LoadIndex(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int64{"a.md": 10, "b.md": 21, "d.md": 40}; !reflect.DeepEqual(reloaded.Stamps(), want) {
+		t.Errorf("Stamps() = %v, want %v", reloaded.Stamps(), want)
+	}
+	for query, want := range map[string][]string{
+		"pears":    {"a.md", "d.md"},
+		"plums":    {"b.md", "d.md"},
+		"cherries": {},
+	} {
+		got := hitPaths(reloaded.Search(Terms(query)))
+		if !sameElements(got, want) {
+			t.Errorf("reloaded Search(%q) = %v, want %v", query, got, want)
+		}
+	}
+	if got, want := reloaded.Search(Terms("pears plums")), loaded.Search(Terms("pears plums")); !reflect.DeepEqual(got, want) {
+		t.Errorf("reloaded scores = %v, want %v", got, want)
+	}
+
+	// An unchanged index isn't written again
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloaded.Save(file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("unchanged index was saved: %v", err)
+	}
+}
+
+func TestLoadIndexFormat(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "old.gob")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gob.NewEncoder(f).Encode(savedIndex{Format: indexFormat + 1}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if _, err := LoadIndex(file); !errors.Is(err, ErrIndexFormat) {
+		t.Errorf("LoadIndex() error = %v, want ErrIndexFormat", err)
+	}
+}
+
+// sameElements reports whether two lists hold the same strings in any order
+func sameElements(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	count := make(map[string]int)
+	for _, s := range a {
+		count[s]++
+	}
+	for _, s := range b {
+		if count[s]--; count[s] < 0 {
+			return false
+		}
+	}
+	return true
+}
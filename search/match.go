@@ -0,0 +1,248 @@
+package search
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// inlineTag matches #tags in text. Tags need a character that is not a
+// digit, so "#1" is not a tag.
+var inlineTag = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_/-]*[\p{L}_/-][\p{L}\p{N}_/-]*)`)
+
+// Document is what a query is matched against. Content and Properties are
+// only needed when the query's NeedsContent is set, and ModTime when its
+// NeedsModTime is set.
+type Document struct {
+	Path    string
+	Content string
+	// Properties are the frontmatter properties, as decoded from JSON
+	Properties map[string]interface{}
+	ModTime    time.Time
+}
+
+// Span is the byte range of a match within a document's content
+type Span struct {
+	Start int
+	End   int
+}
+
+// docMatcher matches nodes against a document, working out its terms and
+// tags when first needed
+type docMatcher struct {
+	doc   *Document
+	terms map[string]bool
+	tags  []string
+}
+
+// Match reports whether a document matches the query
+func (q *Query) Match(doc *Document) bool {
+	m := &docMatcher{doc: doc}
+	return m.match(q.Root)
+}
+
+func (m *docMatcher) match(node Node) bool {
+	switch n := node.(type) {
+	case *And:
+		for _, child := range n.Nodes {
+			if !m.match(child) {
+				return false
+			}
+		}
+		return true
+	case *Or:
+		for _, child := range n.Nodes {
+			if m.match(child) {
+				return true
+			}
+		}
+		return false
+	case *Not:
+		return !m.match(n.Node)
+	case *Word:
+		if n.text != nil {
+			return n.text.MatchString(m.doc.Content)
+		}
+		terms := m.contentTerms()
+		for _, term := range n.terms {
+			if !terms[term] {
+				return false
+			}
+		}
+		return true
+	case *Phrase:
+		return n.re.MatchString(m.doc.Content)
+	case *Regex:
+		return n.re.MatchString(m.doc.Content)
+	case *Path:
+		return containsFold(m.doc.Path, n.Value)
+	case *File:
+		return containsFold(path.Base(m.doc.Path), n.Value)
+	case *Tag:
+		for _, tag := range m.contentTags() {
+			if strings.EqualFold(tag, n.Value) || (len(tag) > len(n.Value) && tag[len(n.Value)] == '/' && strings.EqualFold(tag[:len(n.Value)], n.Value)) {
+				return true
+			}
+		}
+		return false
+	case *Prop:
+		return m.matchProp(n)
+	case *Modified:
+		return n.matchTime(m.doc.ModTime)
+	}
+	return false
+}
+
+// contentTerms returns the set of index terms of the content
+func (m *docMatcher) contentTerms() map[string]bool {
+	if m.terms == nil {
+		m.terms = make(map[string]bool)
+		for _, token := range Tokenize(m.doc.Content) {
+			m.terms[token.Term] = true
+		}
+	}
+	return m.terms
+}
+
+// contentTags returns the tags of the frontmatter "tags" property and the
+// #tags in the content, without the #
+func (m *docMatcher) contentTags() []string {
+	if m.tags != nil {
+		return m.tags
+	}
+	m.tags = []string{}
+	for key, value := range m.doc.Properties {
+		if !strings.EqualFold(key, "tags") && !strings.EqualFold(key, "tag") {
+			continue
+		}
+		for _, item := range propertyItems(value) {
+			// A single string can hold several tags separated by commas
+			// or spaces
+			for _, tag := range strings.FieldsFunc(item, func(r rune) bool { return r == ',' || r == ' ' }) {
+				m.tags = append(m.tags, strings.TrimPrefix(tag, "#"))
+			}
+		}
+	}
+	for _, match := range inlineTag.FindAllStringSubmatch(m.doc.Content, -1) {
+		m.tags = append(m.tags, match[1])
+	}
+	return m.tags
+}
+
+// matchProp matches a frontmatter property, ignoring the case of its key
+// and value
+func (m *docMatcher) matchProp(n *Prop) bool {
+	for key, value := range m.doc.Properties {
+		if !strings.EqualFold(key, n.Key) {
+			continue
+		}
+		if !n.HasValue {
+			return true
+		}
+		for _, item := range propertyItems(value) {
+			if strings.EqualFold(item, n.Value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// propertyItems returns the items of a list property, or the value of any
+// other property, as text
+func propertyItems(value interface{}) []string {
+	switch v := value.(type) {
+	case nil:
+		return []string{""}
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, propertyItems(item)...)
+		}
+		return items
+	}
+	return []string{fmt.Sprint(value)}
+}
+
+// matchTime compares a modification time with the range of the query.
+// Documents without a known modification time never match.
+func (n *Modified) matchTime(t time.Time) bool {
+	if t.IsZero() {
+		return false
+	}
+	switch n.Op {
+	case ">":
+		return !t.Before(n.End)
+	case ">=":
+		return !t.Before(n.Start)
+	case "<":
+		return t.Before(n.Start)
+	case "<=":
+		return t.Before(n.End)
+	}
+	return !t.Before(n.Start) && t.Before(n.End)
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// Highlights returns the spans of content matched by the words, phrases
+// and regular expressions of the query that are not under NOT, in order
+// and without overlaps
+func (q *Query) Highlights(content string) []Span {
+	wanted := make(map[string]bool)
+	var patterns []*regexp.Regexp
+	walk(q.Root, false, func(node Node, negated bool) {
+		if negated {
+			return
+		}
+		switch n := node.(type) {
+		case *Word:
+			if n.text != nil {
+				patterns = append(patterns, n.text)
+			}
+			for _, term := range n.terms {
+				wanted[term] = true
+			}
+		case *Phrase:
+			patterns = append(patterns, n.re)
+		case *Regex:
+			patterns = append(patterns, n.re)
+		}
+	})
+
+	var spans []Span
+	if len(wanted) > 0 {
+		for _, token := range Tokenize(content) {
+			if wanted[token.Term] {
+				spans = append(spans, Span{Start: token.Start, End: token.End})
+			}
+		}
+	}
+	for _, re := range patterns {
+		for _, loc := range re.FindAllStringIndex(content, -1) {
+			if loc[1] > loc[0] {
+				spans = append(spans, Span{Start: loc[0], End: loc[1]})
+			}
+		}
+	}
+
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].Start != spans[j].Start {
+			return spans[i].Start < spans[j].Start
+		}
+		return spans[i].End > spans[j].End
+	})
+	merged := spans[:0]
+	for _, span := range spans {
+		if len(merged) > 0 && span.Start < merged[len(merged)-1].End {
+			continue
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
@@ -0,0 +1,661 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrInvalidQuery is returned, wrapped in a *ParseError, for queries that
+// can't be parsed
+var ErrInvalidQuery = errors.New("invalid query")
+
+// ParseError describes where and why a query could not be parsed
+type ParseError struct {
+	Query  string
+	Column int // 1-based, in characters
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid query %q at column %d: %s", e.Query, e.Column, e.Msg)
+}
+
+func (e *ParseError) Unwrap() error {
+	return ErrInvalidQuery
+}
+
+// Query is a parsed search query. Its syntax is:
+//
+//	word                 notes containing the word or another form of it
+//	"exact phrase"       notes containing the phrase, ignoring case
+//	/pattern/            notes matching a regular expression
+//	path:Projects/       notes whose path contains the text
+//	file:meeting         notes whose file name contains the text
+//	tag:project          notes tagged #project or #project/...
+//	prop:status=done     notes whose frontmatter property has the value
+//	prop:status          notes that have the frontmatter property
+//	modified:>2025-01-01 notes modified after a date (also >=, <, <=, =)
+//	a b, a AND b         notes matching both
+//	a OR b               notes matching either
+//	NOT a, -a            notes not matching
+//	( ... )              grouping
+//
+// NOT binds tighter than AND, which binds tighter than OR. Field values
+// with spaces can be quoted, as in path:"My Folder".
+type Query struct {
+	Root Node
+	// plain is set when the query is only words, with no syntax
+	plain bool
+}
+
+// Node is a node of a parsed query
+type Node interface {
+	// String renders the node in query syntax
+	String() string
+}
+
+// And matches documents matching all of its nodes
+type And struct{ Nodes []Node }
+
+// Or matches documents matching any of its nodes
+type Or struct{ Nodes []Node }
+
+// Not matches documents not matching its node
+type Not struct{ Node Node }
+
+// Word matches documents containing one of its forms. Words that are only
+// stopwords or punctuation are matched as text.
+type Word struct {
+	Text  string
+	terms []string
+	text  *regexp.Regexp
+}
+
+// Phrase matches documents containing the text, ignoring case and
+// treating any run of whitespace as a single space
+type Phrase struct {
+	Text string
+	re   *regexp.Regexp
+}
+
+// Regex matches documents whose content matches a regular expression
+type Regex struct {
+	Pattern string
+	re      *regexp.Regexp
+}
+
+// Path matches documents whose path contains the value, ignoring case
+type Path struct{ Value string }
+
+// File matches documents whose file name contains the value, ignoring case
+type File struct{ Value string }
+
+// Tag matches documents with the tag or a tag nested below it
+type Tag struct{ Value string }
+
+// Prop matches documents with a frontmatter property, and with the given
+// value if HasValue is set. List properties match if any item does.
+type Prop struct {
+	Key      string
+	Value    string
+	HasValue bool
+}
+
+// Modified matches documents by modification time. Start and End bound
+// the time given in the query, such as the whole day of a date, and Op
+// compares against that range.
+type Modified struct {
+	Op    string
+	Value string
+	Start time.Time
+	End   time.Time
+}
+
+func (n *And) String() string    { return "(" + joinNodes(n.Nodes, " AND ") + ")" }
+func (n *Or) String() string     { return "(" + joinNodes(n.Nodes, " OR ") + ")" }
+func (n *Not) String() string    { return "NOT " + n.Node.String() }
+func (n *Word) String() string   { return n.Text }
+func (n *Phrase) String() string { return quote(n.Text) }
+func (n *Regex) String() string  { return "/" + strings.ReplaceAll(n.Pattern, "/", `\/`) + "/" }
+func (n *Path) String() string   { return "path:" + quoteValue(n.Value) }
+func (n *File) String() string   { return "file:" + quoteValue(n.Value) }
+func (n *Tag) String() string    { return "tag:" + quoteValue(n.Value) }
+func (n *Prop) String() string {
+	if !n.HasValue {
+		return "prop:" + quoteValue(n.Key)
+	}
+	return "prop:" + quoteValue(n.Key+"="+n.Value)
+}
+func (n *Modified) String() string { return "modified:" + n.Op + n.Value }
+
+func joinNodes(nodes []Node, sep string) string {
+	parts := make([]string, len(nodes))
+	for i, node := range nodes {
+		parts[i] = node.String()
+	}
+	return strings.Join(parts, sep)
+}
+
+func quote(text string) string {
+	return `"` + strings.ReplaceAll(strings.ReplaceAll(text, `\`, `\\`), `"`, `\"`) + `"`
+}
+
+func quoteValue(value string) string {
+	if strings.ContainsAny(value, " \t\n\"()") {
+		return quote(value)
+	}
+	return value
+}
+
+// Query operators
+const (
+	opAnd = "AND"
+	opOr  = "OR"
+	opNot = "NOT"
+)
+
+// tokenKind is the kind of a lexical token of a query
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokPhrase
+	tokRegex
+	tokField
+	tokAnd
+	tokOr
+	tokNot
+	tokOpen
+	tokClose
+)
+
+// queryToken is a lexical token of a query. For fields, text is the field
+// name and value its value.
+type queryToken struct {
+	kind  tokenKind
+	text  string
+	value string
+	pos   int
+}
+
+// fields are the names accepted before a colon
+var fields = map[string]bool{"path": true, "file": true, "tag": true, "prop": true, "modified": true}
+
+// String names a token in error messages
+func (t queryToken) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokOpen:
+		return `"("`
+	case tokClose:
+		return `")"`
+	case tokAnd, tokOr, tokNot:
+		return t.text
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// queryLexer splits a query into tokens
+type queryLexer struct {
+	text string
+	pos  int
+}
+
+func (l *queryLexer) errorf(pos int, format string, args ...interface{}) error {
+	return &ParseError{Query: l.text, Column: utf8.RuneCountInString(l.text[:pos]) + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+// next returns the next token of the query
+func (l *queryLexer) next() (queryToken, error) {
+	for l.pos < len(l.text) {
+		r, size := utf8.DecodeRuneInString(l.text[l.pos:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		l.pos += size
+	}
+	start := l.pos
+	if l.pos >= len(l.text) {
+		return queryToken{kind: tokEOF, pos: start}, nil
+	}
+
+	switch c := l.text[l.pos]; {
+	case c == '(':
+		l.pos++
+		return queryToken{kind: tokOpen, text: "(", pos: start}, nil
+	case c == ')':
+		l.pos++
+		return queryToken{kind: tokClose, text: ")", pos: start}, nil
+	case c == '-' && l.pos+1 < len(l.text) && !l.endsWord(l.pos+1):
+		l.pos++
+		return queryToken{kind: tokNot, text: "-", pos: start}, nil
+	case c == '"':
+		text, err := l.delimited('"', "quote")
+		if err != nil {
+			return queryToken{}, err
+		}
+		if strings.TrimSpace(text) == "" {
+			return queryToken{}, l.errorf(start, "empty phrase")
+		}
+		return queryToken{kind: tokPhrase, text: text, pos: start}, nil
+	case c == '/':
+		pattern, err := l.delimited('/', "regular expression")
+		if err != nil {
+			return queryToken{}, err
+		}
+		if pattern == "" {
+			return queryToken{}, l.errorf(start, "empty regular expression")
+		}
+		return queryToken{kind: tokRegex, text: pattern, pos: start}, nil
+	}
+
+	for l.pos < len(l.text) && !l.endsWord(l.pos) {
+		if l.text[l.pos] == ':' && fields[strings.ToLower(l.text[start:l.pos])] {
+			return l.field(start)
+		}
+		_, size := utf8.DecodeRuneInString(l.text[l.pos:])
+		l.pos += size
+	}
+	word := l.text[start:l.pos]
+	switch word {
+	case opAnd:
+		return queryToken{kind: tokAnd, text: word, pos: start}, nil
+	case opOr:
+		return queryToken{kind: tokOr, text: word, pos: start}, nil
+	case opNot:
+		return queryToken{kind: tokNot, text: word, pos: start}, nil
+	}
+	return queryToken{kind: tokWord, text: word, pos: start}, nil
+}
+
+// endsWord reports whether the character at pos ends a word
+func (l *queryLexer) endsWord(pos int) bool {
+	r, _ := utf8.DecodeRuneInString(l.text[pos:])
+	return unicode.IsSpace(r) || r == '(' || r == ')'
+}
+
+// field reads the value of a field whose name starts at start and ends at
+// the colon under the cursor
+func (l *queryLexer) field(start int) (queryToken, error) {
+	name := strings.ToLower(l.text[start:l.pos])
+	l.pos++
+	var value string
+	if l.pos < len(l.text) && l.text[l.pos] == '"' {
+		var err error
+		if value, err = l.delimited('"', "quote"); err != nil {
+			return queryToken{}, err
+		}
+	} else {
+		valueStart := l.pos
+		for l.pos < len(l.text) && !l.endsWord(l.pos) {
+			_, size := utf8.DecodeRuneInString(l.text[l.pos:])
+			l.pos += size
+		}
+		value = l.text[valueStart:l.pos]
+	}
+	if value == "" {
+		return queryToken{}, l.errorf(start, "%s: needs a value", name)
+	}
+	return queryToken{kind: tokField, text: name, value: value, pos: start}, nil
+}
+
+// delimited reads text up to the closing delimiter, which can be escaped
+// with a backslash. Other escapes are kept as they are, so regular
+// expressions need no double escaping.
+func (l *queryLexer) delimited(delim byte, what string) (string, error) {
+	start := l.pos
+	l.pos++
+	var text strings.Builder
+	for l.pos < len(l.text) {
+		c := l.text[l.pos]
+		switch {
+		case c == delim:
+			l.pos++
+			return text.String(), nil
+		case c == '\\' && l.pos+1 < len(l.text) && (l.text[l.pos+1] == delim || (delim == '"' && l.text[l.pos+1] == '\\')):
+			text.WriteByte(l.text[l.pos+1])
+			l.pos += 2
+		default:
+			text.WriteByte(c)
+			l.pos++
+		}
+	}
+	return "", l.errorf(start, "unterminated %s", what)
+}
+
+// queryParser builds the tree of a query from its tokens
+type queryParser struct {
+	lexer queryLexer
+	tok   queryToken
+	plain bool
+}
+
+// ParseQuery parses a search query. Errors are *ParseError values telling
+// what is wrong and where.
+func ParseQuery(text string) (*Query, error) {
+	p := &queryParser{lexer: queryLexer{text: text}, plain: true}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokEOF {
+		return nil, p.lexer.errorf(0, "empty query")
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		// parseOr only stops early at a closing parenthesis
+		return nil, p.lexer.errorf(p.tok.pos, `unmatched ")"`)
+	}
+	plain := p.plain
+	walk(root, false, func(node Node, _ bool) {
+		if word, ok := node.(*Word); ok && len(word.terms) == 0 {
+			plain = false
+		}
+	})
+	return &Query{Root: root, plain: plain}, nil
+}
+
+func (p *queryParser) advance() error {
+	tok, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	if tok.kind != tokWord && tok.kind != tokEOF {
+		p.plain = false
+	}
+	p.tok = tok
+	return nil
+}
+
+// parseOr parses terms joined by OR
+func (p *queryParser) parseOr() (Node, error) {
+	node, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []Node{node}
+	for p.tok.kind == tokOr {
+		op := p.tok
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if !p.startsTerm() {
+			return nil, p.lexer.errorf(op.pos, "expected a term after OR, found %s", p.tok)
+		}
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return &Or{Nodes: nodes}, nil
+}
+
+// parseAnd parses terms joined by AND or written next to each other
+func (p *queryParser) parseAnd() (Node, error) {
+	if !p.startsTerm() {
+		return nil, p.lexer.errorf(p.tok.pos, "expected a term, found %s", p.tok)
+	}
+	node, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []Node{node}
+	for {
+		if p.tok.kind == tokAnd {
+			op := p.tok
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if !p.startsTerm() {
+				return nil, p.lexer.errorf(op.pos, "expected a term after AND, found %s", p.tok)
+			}
+		} else if !p.startsTerm() {
+			break
+		}
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return &And{Nodes: nodes}, nil
+}
+
+// startsTerm reports whether the current token can start a term
+func (p *queryParser) startsTerm() bool {
+	switch p.tok.kind {
+	case tokWord, tokPhrase, tokRegex, tokField, tokNot, tokOpen:
+		return true
+	}
+	return false
+}
+
+// parseUnary parses a term with any number of NOTs before it
+func (p *queryParser) parseUnary() (Node, error) {
+	if p.tok.kind == tokNot {
+		op := p.tok
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if !p.startsTerm() {
+			return nil, p.lexer.errorf(op.pos, "expected a term after %s, found %s", op.text, p.tok)
+		}
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Node: node}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary parses a parenthesized query or a single term
+func (p *queryParser) parsePrimary() (Node, error) {
+	tok := p.tok
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	switch tok.kind {
+	case tokOpen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokClose {
+			return nil, p.lexer.errorf(tok.pos, `missing ")" for this "("`)
+		}
+		return node, p.advance()
+	case tokWord:
+		return newWord(tok.text), nil
+	case tokPhrase:
+		return newPhrase(tok.text), nil
+	case tokRegex:
+		re, err := regexp.Compile(tok.text)
+		if err != nil {
+			return nil, p.lexer.errorf(tok.pos, "invalid regular expression: %v", strings.TrimPrefix(err.Error(), "error parsing regexp: "))
+		}
+		return &Regex{Pattern: tok.text, re: re}, nil
+	case tokField:
+		return p.parseField(tok)
+	}
+	return nil, p.lexer.errorf(tok.pos, "expected a term, found %s", tok)
+}
+
+// parseField builds the node of a field
+func (p *queryParser) parseField(tok queryToken) (Node, error) {
+	switch tok.text {
+	case "path":
+		return &Path{Value: tok.value}, nil
+	case "file":
+		return &File{Value: tok.value}, nil
+	case "tag":
+		tag := strings.TrimPrefix(tok.value, "#")
+		if tag == "" {
+			return nil, p.lexer.errorf(tok.pos, "tag: needs a tag name")
+		}
+		return &Tag{Value: tag}, nil
+	case "prop":
+		key, value, hasValue := strings.Cut(tok.value, "=")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, p.lexer.errorf(tok.pos, "prop: needs a property name, as in prop:status=done")
+		}
+		return &Prop{Key: key, Value: strings.TrimSpace(value), HasValue: hasValue}, nil
+	case "modified":
+		return p.parseModified(tok)
+	}
+	return nil, p.lexer.errorf(tok.pos, "unknown field %s:", tok.text)
+}
+
+// modifiedLayouts are the accepted time formats of modified:, with the
+// precision of each
+var modifiedLayouts = []struct {
+	layout    string
+	precision time.Duration
+}{
+	{"2006-01-02", 24 * time.Hour},
+	{"2006-01-02T15:04", time.Minute},
+	{"2006-01-02T15:04:05", time.Second},
+	{time.RFC3339, time.Second},
+}
+
+// parseModified parses a comparison with a date or time, which is in the
+// server's time zone unless it has an offset
+func (p *queryParser) parseModified(tok queryToken) (Node, error) {
+	op := "="
+	value := tok.value
+	for _, prefix := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(value, prefix) {
+			op, value = prefix, value[len(prefix):]
+			break
+		}
+	}
+
+	for _, format := range modifiedLayouts {
+		start, err := time.ParseInLocation(format.layout, value, time.Local)
+		if err != nil {
+			continue
+		}
+		end := start.Add(format.precision)
+		if format.precision == 24*time.Hour {
+			// Days are not always 24 hours long
+			end = start.AddDate(0, 0, 1)
+		}
+		return &Modified{Op: op, Value: value, Start: start, End: end}, nil
+	}
+	return nil, p.lexer.errorf(tok.pos, "invalid date %q for modified:, use YYYY-MM-DD or YYYY-MM-DDTHH:MM[:SS], optionally after >, >=, <, <= or =", value)
+}
+
+func newWord(text string) *Word {
+	word := &Word{Text: text, terms: Terms(text)}
+	if len(word.terms) == 0 {
+		word.text = regexp.MustCompile("(?i)" + regexp.QuoteMeta(text))
+	}
+	return word
+}
+
+func newPhrase(text string) *Phrase {
+	parts := strings.Fields(text)
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return &Phrase{Text: text, re: regexp.MustCompile(`(?i)` + strings.Join(parts, `\s+`))}
+}
+
+// Plain reports whether the query is only words, without any operators,
+// phrases or fields, and each word has index terms. An index finds exactly
+// the notes matching a plain query without reading them.
+func (q *Query) Plain() bool {
+	return q.plain
+}
+
+// String renders the query with explicit operators and parentheses
+func (q *Query) String() string {
+	return q.Root.String()
+}
+
+// Terms returns the index terms of the words and phrases the query looks
+// for, leaving out those under NOT, for ranking results
+func (q *Query) Terms() []string {
+	var terms []string
+	seen := make(map[string]bool)
+	walk(q.Root, false, func(node Node, negated bool) {
+		if negated {
+			return
+		}
+		var add []string
+		switch n := node.(type) {
+		case *Word:
+			add = n.terms
+		case *Phrase:
+			add = Terms(n.Text)
+		}
+		for _, term := range add {
+			if !seen[term] {
+				seen[term] = true
+				terms = append(terms, term)
+			}
+		}
+	})
+	return terms
+}
+
+// NeedsContent reports whether matching the query needs the content of
+// documents, rather than only their path and modification time
+func (q *Query) NeedsContent() bool {
+	needs := false
+	walk(q.Root, false, func(node Node, _ bool) {
+		switch node.(type) {
+		case *Word, *Phrase, *Regex, *Tag, *Prop:
+			needs = true
+		}
+	})
+	return needs
+}
+
+// NeedsModTime reports whether matching the query needs the modification
+// time of documents
+func (q *Query) NeedsModTime() bool {
+	needs := false
+	walk(q.Root, false, func(node Node, _ bool) {
+		if _, ok := node.(*Modified); ok {
+			needs = true
+		}
+	})
+	return needs
+}
+
+// walk calls fn for every node of a tree, telling whether it is under an
+// odd number of NOTs
+func walk(node Node, negated bool, fn func(node Node, negated bool)) {
+	fn(node, negated)
+	switch n := node.(type) {
+	case *And:
+		for _, child := range n.Nodes {
+			walk(child, negated, fn)
+		}
+	case *Or:
+		for _, child := range n.Nodes {
+			walk(child, negated, fn)
+		}
+	case *Not:
+		walk(n.Node, !negated, fn)
+	}
+}
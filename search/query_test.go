@@ -0,0 +1,206 @@
+package search
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+		plain bool
+	}{
+		{query: "garden", want: "garden", plain: true},
+		{query: "garden roses", want: "(garden AND roses)", plain: true},
+		{query: "a1 AND b1 OR c1", want: "((a1 AND b1) OR c1)"},
+		{query: "a1 OR b1 c1", want: "(a1 OR (b1 AND c1))"},
+		{query: "NOT a1 b1", want: "(NOT a1 AND b1)"},
+		{query: "NOT (a1 OR b1)", want: "NOT (a1 OR b1)"},
+		{query: "NOT NOT a1", want: "NOT NOT a1"},
+		{query: "-draft notes", want: "(NOT draft AND notes)"},
+		{query: "-path:Archive", want: "NOT path:Archive"},
+		// A dash inside or after a word is part of it
+		{query: "x-ray -", want: "(x-ray AND -)"},
+		// Operators are upper case only
+		{query: "cats and dogs", want: "(cats AND and AND dogs)"},
+		{query: "(a1 OR b1) (c1 OR d1)", want: "((a1 OR b1) AND (c1 OR d1))"},
+		{query: `"exact  phrase"`, want: `"exact  phrase"`},
+		{query: `"say \"hi\""`, want: `"say \"hi\""`},
+		{query: `/\d+ items/`, want: `/\d+ items/`},
+		{query: `/a\/b/`, want: `/a\/b/`},
+		{query: `path:"Daily Notes" file:meeting`, want: `(path:"Daily Notes" AND file:meeting)`},
+		{query: "PATH:Projects/", want: "path:Projects/"},
+		{query: "tag:#project/alpha", want: "tag:project/alpha"},
+		{query: `prop:status=done prop:"due date"`, want: `(prop:status=done AND prop:"due date")`},
+		{query: `prop:"status = in progress"`, want: `prop:"status=in progress"`},
+		{query: "modified:>=2025-06-01", want: "modified:>=2025-06-01"},
+		{query: "modified:2025-06-01T10:30", want: "modified:=2025-06-01T10:30"},
+		// Unknown fields are words
+		{query: "note:x", want: "note:x", plain: true},
+		// Words of only stopwords are matched as text
+		{query: "the", want: "the"},
+		{query: "the garden", want: "(the AND garden)"},
+	}
+
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) error = %v", tt.query, err)
+			continue
+		}
+		if got := q.String(); got != tt.want {
+			t.Errorf("ParseQuery(%q) = %s, want %s", tt.query, got, tt.want)
+		}
+		if q.Plain() != tt.plain {
+			t.Errorf("ParseQuery(%q).Plain() = %t, want %t", tt.query, q.Plain(), tt.plain)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query  string
+		column int
+		msg    string
+	}{
+		{query: "", column: 1, msg: "empty query"},
+		{query: "   ", column: 1, msg: "empty query"},
+		{query: "a1 OR", column: 4, msg: "expected a term after OR, found end of query"},
+		{query: "a1 AND OR b1", column: 4, msg: "expected a term after AND"},
+		{query: "OR a1", column: 1, msg: "expected a term, found OR"},
+		{query: "NOT", column: 1, msg: "expected a term after NOT"},
+		{query: "(a1 b1", column: 1, msg: `missing ")"`},
+		{query: "a1 b1)", column: 6, msg: `unmatched ")"`},
+		{query: "()", column: 2, msg: `expected a term, found ")"`},
+		{query: `a1 "open`, column: 4, msg: "unterminated quote"},
+		{query: `""`, column: 1, msg: "empty phrase"},
+		{query: "/open", column: 1, msg: "unterminated regular expression"},
+		{query: "//", column: 1, msg: "empty regular expression"},
+		{query: "é /a(/", column: 3, msg: "invalid regular expression"},
+		{query: "path:", column: 1, msg: "path: needs a value"},
+		{query: `file:""`, column: 1, msg: "file: needs a value"},
+		{query: "tag:#", column: 1, msg: "tag: needs a tag name"},
+		{query: "prop:=done", column: 1, msg: "prop: needs a property name"},
+		{query: "a1 modified:>yesterday", column: 4, msg: "modified:"},
+		{query: `path:"Daily`, column: 6, msg: "unterminated quote"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseQuery(tt.query)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("ParseQuery(%q) error = %v, want a *ParseError", tt.query, err)
+			continue
+		}
+		if !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("ParseQuery(%q) error doesn't wrap ErrInvalidQuery", tt.query)
+		}
+		if parseErr.Column != tt.column || !strings.Contains(parseErr.Msg, tt.msg) {
+			t.Errorf("ParseQuery(%q) error at column %d: %q, want column %d: %q", tt.query, parseErr.Column, parseErr.Msg, tt.column, tt.msg)
+		}
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	doc := &Document{
+		Path:    "Projects/Garden Plan.md",
+		Content: "# Garden\nPlanting roses in spring. Order 12 items. #project/alpha",
+		Properties: map[string]interface{}{
+			"status": "In Progress",
+			"tags":   []interface{}{"home", "#outdoor"},
+			"due":    nil,
+		},
+		ModTime: time.Date(2025, 6, 1, 15, 30, 0, 0, time.Local),
+	}
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"garden", true},
+		{"GARDEN", true},
+		{"planted", true},
+		{"rose spring", true},
+		{"roses winter", false},
+		{"roses OR winter", true},
+		{"winter OR summer", false},
+		{"NOT winter", true},
+		{"-roses", false},
+		{"roses -winter", true},
+		{"roses -spring", false},
+		{"-roses OR spring", true},
+		{"NOT (roses OR winter)", false},
+		{"winter OR roses spring", true},
+		{"(winter OR roses) NOT spring", false},
+		{`"roses in spring"`, true},
+		{`"ROSES  in   spring"`, true},
+		{`"spring roses"`, false},
+		{`/\d+ items/`, true},
+		{`/^# Garden$/`, false},
+		{`/(?m)^# Garden$/`, true},
+		{"in", true},
+		{"the", false},
+		{"path:projects/", true},
+		{`path:"Garden Plan"`, true},
+		{"path:Archive", false},
+		{"file:plan", true},
+		{"file:Projects", false},
+		{"tag:project", true},
+		{"tag:project/alpha", true},
+		{"tag:proj", false},
+		{"tag:outdoor", true},
+		{"tag:HOME", true},
+		{"prop:status", true},
+		{"prop:due", true},
+		{"prop:owner", false},
+		{`prop:"status=in progress"`, true},
+		{"prop:status=done", false},
+		{"modified:2025-06-01", true},
+		{"modified:=2025-06-02", false},
+		{"modified:>2025-05-31", true},
+		{"modified:>2025-06-01", false},
+		{"modified:>=2025-06-01", true},
+		{"modified:<2025-06-01", false},
+		{"modified:<=2025-06-01", true},
+		{"modified:<2025-06-02", true},
+		{"modified:>=2025-06-01T15:30", true},
+		{"modified:>2025-06-01T15:30", false},
+		{"modified:<2025-06-01T15:30:01", true},
+	}
+
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) error = %v", tt.query, err)
+			continue
+		}
+		if got := q.Match(doc); got != tt.want {
+			t.Errorf("%q matches = %t, want %t", tt.query, got, tt.want)
+		}
+	}
+
+	// Documents without a modification time never match modified:
+	q, _ := ParseQuery("modified:<2030-01-01")
+	if q.Match(&Document{Path: "a.md"}) {
+		t.Error("document without a modification time matched modified:")
+	}
+}
+
+func TestQueryHighlights(t *testing.T) {
+	content := "Roses and more roses; no winter roses. Spring"
+	q, err := ParseQuery(`rose -winter OR "more roses" OR /Spr\w+/`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, span := range q.Highlights(content) {
+		got = append(got, content[span.Start:span.End])
+	}
+	want := []string{"Roses", "more roses", "roses", "Spring"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Highlights() = %q, want %q", got, want)
+	}
+}
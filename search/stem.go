@@ -0,0 +1,252 @@
+package search
+
+// Stem reduces a lower-case English word to its stem with the Porter
+// stemming algorithm, so that "connected", "connecting" and "connections"
+// all become "connect". Words of up to two letters and words with letters
+// outside a-z are returned unchanged.
+func Stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+
+	s := &stemmer{b: []byte(word)}
+	s.step1ab()
+	if len(s.b) > 1 {
+		s.step1c()
+		s.step2()
+		s.step3()
+		s.step4()
+		s.step5()
+	}
+	return string(s.b)
+}
+
+// stemmer holds a word being stemmed. j marks the end of the stem when a
+// suffix has been matched by ends.
+type stemmer struct {
+	b []byte
+	j int
+}
+
+// k returns the index of the last letter
+func (s *stemmer) k() int {
+	return len(s.b) - 1
+}
+
+// cons reports whether the letter at i is a consonant
+func (s *stemmer) cons(i int) bool {
+	switch s.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !s.cons(i-1)
+	default:
+		return true
+	}
+}
+
+// m measures the number of consonant sequences in b[0..j]: with c a
+// consonant sequence and v a vowel sequence, [c](vc){m}[v] gives m
+func (s *stemmer) m() int {
+	n, i := 0, 0
+	for {
+		if i > s.j {
+			return n
+		}
+		if !s.cons(i) {
+			break
+		}
+		i++
+	}
+	i++
+	for {
+		for {
+			if i > s.j {
+				return n
+			}
+			if s.cons(i) {
+				break
+			}
+			i++
+		}
+		i++
+		n++
+		for {
+			if i > s.j {
+				return n
+			}
+			if !s.cons(i) {
+				break
+			}
+			i++
+		}
+		i++
+	}
+}
+
+// vowelInStem reports whether b[0..j] contains a vowel
+func (s *stemmer) vowelInStem() bool {
+	for i := 0; i <= s.j; i++ {
+		if !s.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doublec reports whether b[i-1..i] is a double consonant
+func (s *stemmer) doublec(i int) bool {
+	return i >= 1 && s.b[i] == s.b[i-1] && s.cons(i)
+}
+
+// cvc reports whether b[i-2..i] is consonant-vowel-consonant with the last
+// consonant not w, x or y, as in "hop" but not "snow"
+func (s *stemmer) cvc(i int) bool {
+	if i < 2 || !s.cons(i) || s.cons(i-1) || !s.cons(i-2) {
+		return false
+	}
+	switch s.b[i] {
+	case 'w', 'x', 'y':
+		return false
+	}
+	return true
+}
+
+// ends reports whether the word ends with suffix, and if so sets j to the
+// end of the stem before it
+func (s *stemmer) ends(suffix string) bool {
+	n := len(suffix)
+	if n > len(s.b) || string(s.b[len(s.b)-n:]) != suffix {
+		return false
+	}
+	s.j = len(s.b) - n - 1
+	return true
+}
+
+// setTo replaces the letters after j with replacement
+func (s *stemmer) setTo(replacement string) {
+	s.b = append(s.b[:s.j+1], replacement...)
+}
+
+// replace replaces the first matching suffix of rules with its replacement
+// if the stem before it has a measure above zero
+func (s *stemmer) replace(rules [][2]string) {
+	for _, rule := range rules {
+		if s.ends(rule[0]) {
+			if s.m() > 0 {
+				s.setTo(rule[1])
+			}
+			return
+		}
+	}
+}
+
+// step1ab removes plurals and -ed or -ing
+func (s *stemmer) step1ab() {
+	if s.b[s.k()] == 's' {
+		switch {
+		case s.ends("sses"):
+			s.b = s.b[:len(s.b)-2]
+		case s.ends("ies"):
+			s.setTo("i")
+		case s.b[s.k()-1] != 's':
+			s.b = s.b[:len(s.b)-1]
+		}
+	}
+
+	if s.ends("eed") {
+		if s.m() > 0 {
+			s.b = s.b[:len(s.b)-1]
+		}
+	} else if (s.ends("ed") || s.ends("ing")) && s.vowelInStem() {
+		s.b = s.b[:s.j+1]
+		switch {
+		case s.ends("at"):
+			s.setTo("ate")
+		case s.ends("bl"):
+			s.setTo("ble")
+		case s.ends("iz"):
+			s.setTo("ize")
+		case s.doublec(s.k()):
+			if c := s.b[s.k()]; c != 'l' && c != 's' && c != 'z' {
+				s.b = s.b[:len(s.b)-1]
+			}
+		default:
+			s.j = s.k()
+			if s.m() == 1 && s.cvc(s.k()) {
+				s.setTo("e")
+			}
+		}
+	}
+}
+
+// step1c turns a terminal y into i when there is another vowel in the stem
+func (s *stemmer) step1c() {
+	if s.ends("y") && s.vowelInStem() {
+		s.b[s.k()] = 'i'
+	}
+}
+
+// step2 maps double suffixes to single ones, e.g. -ization to -ize
+func (s *stemmer) step2() {
+	s.replace([][2]string{
+		{"ational", "ate"}, {"tional", "tion"},
+		{"enci", "ence"}, {"anci", "ance"},
+		{"izer", "ize"},
+		{"bli", "ble"}, {"alli", "al"}, {"entli", "ent"}, {"eli", "e"}, {"ousli", "ous"},
+		{"ization", "ize"}, {"ation", "ate"}, {"ator", "ate"},
+		{"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"}, {"ousness", "ous"},
+		{"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"},
+		{"logi", "log"},
+	})
+}
+
+// step3 handles -ic-, -full, -ness and similar suffixes
+func (s *stemmer) step3() {
+	s.replace([][2]string{
+		{"icate", "ic"}, {"ative", ""}, {"alize", "al"},
+		{"iciti", "ic"}, {"ical", "ic"}, {"ful", ""}, {"ness", ""},
+	})
+}
+
+// step4 removes -ant, -ence and similar suffixes from longer stems
+func (s *stemmer) step4() {
+	suffixes := []string{
+		"al", "ance", "ence", "er", "ic", "able", "ible",
+		"ant", "ement", "ment", "ent", "ion", "ou", "ism",
+		"ate", "iti", "ous", "ive", "ize",
+	}
+	for _, suffix := range suffixes {
+		if !s.ends(suffix) {
+			continue
+		}
+		if suffix == "ion" && (s.j < 0 || (s.b[s.j] != 's' && s.b[s.j] != 't')) {
+			return
+		}
+		if s.m() > 1 {
+			s.b = s.b[:s.j+1]
+		}
+		return
+	}
+}
+
+// step5 removes a final -e and turns -ll into -l on longer stems. Both
+// rules measure the word as it was before the step.
+func (s *stemmer) step5() {
+	s.j = s.k()
+	end := len(s.b)
+	if s.b[end-1] == 'e' {
+		if a := s.m(); a > 1 || (a == 1 && !s.cvc(end-2)) {
+			end--
+		}
+	}
+	if s.b[end-1] == 'l' && s.doublec(end-1) && s.m() > 1 {
+		end--
+	}
+	s.b = s.b[:end]
+}
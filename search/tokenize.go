@@ -0,0 +1,84 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// maxTermLength is the longest word indexed, in bytes. Longer runs of
+// letters are mostly encoded data such as embedded images.
+const maxTermLength = 64
+
+// stopwords are common English words that are not indexed
+var stopwords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`
+		a about above after again against all am an and any are as at be
+		because been before being below between both but by can could did do
+		does doing down during each few for from further had has have having
+		he her here hers herself him himself his how i if in into is it its
+		itself just me more most my myself no nor not now of off on once only
+		or other our ours ourselves out over own same she should so some such
+		than that the their theirs them themselves then there these they this
+		those through to too under until up very was we were what when where
+		which while who whom why will with would you your yours yourself
+		yourselves s t d ll m re ve`) {
+		stopwords[word] = true
+	}
+}
+
+// Token is a word of a text as an index term, with its byte offsets in the
+// text
+type Token struct {
+	Term  string
+	Start int
+	End   int
+}
+
+// Tokenize splits text into words of letters and digits, lower-cases and
+// stems them, and drops stopwords
+func Tokenize(text string) []Token {
+	var tokens []Token
+	start := -1
+	for i, r := range text {
+		wordRune := unicode.IsLetter(r) || unicode.IsNumber(r)
+		if wordRune && start < 0 {
+			start = i
+		}
+		if !wordRune && start >= 0 {
+			tokens = appendToken(tokens, text, start, i)
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = appendToken(tokens, text, start, len(text))
+	}
+	return tokens
+}
+
+// Terms returns the distinct index terms of text, in order of appearance
+func Terms(text string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, token := range Tokenize(text) {
+		if !seen[token.Term] {
+			seen[token.Term] = true
+			terms = append(terms, token.Term)
+		}
+	}
+	return terms
+}
+
+// appendToken appends the word text[start:end] unless it is a stopword, a
+// single letter or too long
+func appendToken(tokens []Token, text string, start, end int) []Token {
+	if end-start > maxTermLength {
+		return tokens
+	}
+	word := strings.ToLower(text[start:end])
+	if stopwords[word] || (len(word) == 1 && word[0] >= 'a' && word[0] <= 'z') {
+		return tokens
+	}
+	return append(tokens, Token{Term: Stem(word), Start: start, End: end})
+}
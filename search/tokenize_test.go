@@ -0,0 +1,95 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []Token
+	}{
+		{"", nil},
+		{"the and of", nil},
+		{"Running dogs", []Token{{"run", 0, 7}, {"dog", 8, 12}}},
+		{"x-ray, v2.0!", []Token{{"rai", 2, 5}, {"v2", 7, 9}, {"0", 10, 11}}},
+		{"Café straße", []Token{{"café", 0, 5}, {"straße", 6, 13}}},
+		{"ÜBER über", []Token{{"über", 0, 5}, {"über", 6, 11}}},
+		{"日本語 text", []Token{{"日本語", 0, 9}, {"text", 10, 14}}},
+		{"a b c 7", []Token{{"7", 6, 7}}},
+		{"#tag [[Link]]", []Token{{"tag", 1, 4}, {"link", 7, 11}}},
+		{"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa word", []Token{{"word", 66, 70}}},
+	}
+
+	for _, tt := range tests {
+		if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTerms(t *testing.T) {
+	got := Terms("Connect the connections, connected and connecting")
+	if want := []string{"connect"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Terms() = %v, want %v", got, want)
+	}
+}
+
+func TestStem(t *testing.T) {
+	tests := map[string]string{
+		// Step 1a
+		"caresses": "caress",
+		"ponies":   "poni",
+		"caress":   "caress",
+		"cats":     "cat",
+		// Step 1b
+		"feed":      "feed",
+		"agreed":    "agre",
+		"plastered": "plaster",
+		"bled":      "bled",
+		"motoring":  "motor",
+		"sing":      "sing",
+		"conflated": "conflat",
+		"troubled":  "troubl",
+		"sized":     "size",
+		"hopping":   "hop",
+		"tanned":    "tan",
+		"falling":   "fall",
+		"hissing":   "hiss",
+		"fizzed":    "fizz",
+		"failing":   "fail",
+		"filing":    "file",
+		// Step 1c
+		"happy": "happi",
+		"sky":   "sky",
+		// Steps 2 to 5
+		"relational":      "relat",
+		"conditional":     "condit",
+		"rational":        "ration",
+		"digitizer":       "digit",
+		"operator":        "oper",
+		"hopefulness":     "hope",
+		"formality":       "formal",
+		"sensibility":     "sensibl",
+		"triplicate":      "triplic",
+		"electrical":      "electr",
+		"revival":         "reviv",
+		"allowance":       "allow",
+		"adjustment":      "adjust",
+		"adoption":        "adopt",
+		"probate":         "probat",
+		"controll":        "control",
+		"generalizations": "gener",
+		// Left alone
+		"is":     "is",
+		"café":   "café",
+		"abc123": "abc123",
+	}
+
+	for word, want := range tests {
+		if got := Stem(word); got != want {
+			t.Errorf("Stem(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package security
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Operations checked by a Policy
+const (
+	OpRead   = "read"
+	OpWrite  = "write"
+	OpDelete = "delete"
+)
+
+// ErrDenied is returned for operations the policy does not allow
+var ErrDenied = errors.New("access denied")
+
+// PolicyRules lists glob patterns of vault paths. In patterns, * matches
+// within a folder name, ** matches across folders and ? matches one
+// character, e.g. "Private/**" or "Daily/*.md". Matching ignores case, as
+// vaults often live on case-insensitive file systems.
+type PolicyRules struct {
+	Allow []string `yaml:"allow"` // if set, only matching paths are allowed
+	Deny  []string `yaml:"deny"`  // matching paths are never allowed
+}
+
+// PolicyConfig configures a Policy. The top-level rules apply to every
+// operation, in addition to the rules of the operation itself.
+type PolicyConfig struct {
+	PolicyRules `yaml:",inline"`
+	Read        PolicyRules `yaml:"read"`
+	Write       PolicyRules `yaml:"write"`
+	Delete      PolicyRules `yaml:"delete"`
+}
+
+// Policy decides which vault paths each operation may touch. A path is
+// allowed when it matches no deny pattern and, for every rule set with an
+// allow list, at least one allow pattern. A nil Policy allows everything.
+type Policy struct {
+	rules map[string][]compiledRules
+}
+
+type compiledRules struct {
+	allow []compiledGlob
+	deny  []compiledGlob
+}
+
+// compiledGlob is a pattern compiled as a whole, for matching paths, and
+// per segment, for matching the folders paths are in
+type compiledGlob struct {
+	re *regexp.Regexp
+	// segments match one path segment each; nil stands for a ** segment
+	segments []*regexp.Regexp
+	// spans is set when ** appears inside a segment, such as "Pro**", so
+	// the pattern can't be matched segment by segment
+	spans bool
+}
+
+// NewPolicy compiles a policy configuration. It returns nil when no rules
+// are configured.
+func NewPolicy(config PolicyConfig) (*Policy, error) {
+	common, err := compileRules(config.PolicyRules)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &Policy{rules: make(map[string][]compiledRules)}
+	empty := common.empty()
+	for op, rules := range map[string]PolicyRules{OpRead: config.Read, OpWrite: config.Write, OpDelete: config.Delete} {
+		compiled, err := compileRules(rules)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		policy.rules[op] = []compiledRules{common, compiled}
+		empty = empty && compiled.empty()
+	}
+	if empty {
+		return nil, nil
+	}
+	return policy, nil
+}
+
+// Allowed reports whether the policy allows an operation on a path
+func (p *Policy) Allowed(op, notePath string) bool {
+	if p == nil {
+		return true
+	}
+	notePath = path.Clean(strings.TrimPrefix(notePath, "/"))
+	for _, rules := range p.rules[op] {
+		if !rules.allows(notePath) {
+			return false
+		}
+	}
+	return true
+}
+
+// Restricts reports whether any rule limits an operation
+func (p *Policy) Restricts(op string) bool {
+	if p == nil {
+		return false
+	}
+	for _, rules := range p.rules[op] {
+		if !rules.empty() {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedFolder reports whether the policy may allow an operation on some
+// path inside a folder, so a listing can show the folder. A folder is
+// hidden when a deny pattern covers everything in it, such as "Private/**",
+// or when no allow pattern can match anything in it.
+func (p *Policy) AllowedFolder(op, folder string) bool {
+	if p == nil {
+		return true
+	}
+	folder = path.Clean(strings.TrimPrefix(folder, "/"))
+	var segments []string
+	if folder != "." {
+		segments = strings.Split(folder, "/")
+	}
+	for _, rules := range p.rules[op] {
+		if !rules.allowsFolder(segments) {
+			return false
+		}
+	}
+	return true
+}
+
+// Check returns an ErrDenied error if the policy does not allow an
+// operation on a path
+func (p *Policy) Check(op, notePath string) error {
+	if !p.Allowed(op, notePath) {
+		return fmt.Errorf("%w: policy does not allow %s on %s", ErrDenied, op, notePath)
+	}
+	return nil
+}
+
+func (r compiledRules) empty() bool {
+	return len(r.allow) == 0 && len(r.deny) == 0
+}
+
+func (r compiledRules) allows(notePath string) bool {
+	for _, g := range r.deny {
+		if g.re.MatchString(notePath) {
+			return false
+		}
+	}
+	if len(r.allow) == 0 {
+		return true
+	}
+	for _, g := range r.allow {
+		if g.re.MatchString(notePath) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r compiledRules) allowsFolder(folder []string) bool {
+	for _, g := range r.deny {
+		if !g.spans && coversFolder(g.segments, folder) {
+			return false
+		}
+	}
+	if len(r.allow) == 0 {
+		return true
+	}
+	for _, g := range r.allow {
+		if g.spans || reachesInto(g.segments, folder) {
+			return true
+		}
+	}
+	return false
+}
+
+// reachesInto reports whether a pattern can match a path inside folder
+func reachesInto(pattern []*regexp.Regexp, folder []string) bool {
+	switch {
+	case len(folder) == 0:
+		return len(pattern) > 0
+	case len(pattern) == 0:
+		return false
+	case pattern[0] == nil:
+		return reachesInto(pattern[1:], folder) || reachesInto(pattern, folder[1:])
+	default:
+		return pattern[0].MatchString(folder[0]) && reachesInto(pattern[1:], folder[1:])
+	}
+}
+
+// coversFolder reports whether a pattern matches every path inside folder,
+// which is when it can match the folder followed by a final ** segment
+func coversFolder(pattern []*regexp.Regexp, folder []string) bool {
+	switch {
+	case len(folder) == 0:
+		return len(pattern) == 1 && pattern[0] == nil
+	case len(pattern) == 0:
+		return false
+	case pattern[0] == nil:
+		return coversFolder(pattern[1:], folder) || coversFolder(pattern, folder[1:])
+	default:
+		return pattern[0].MatchString(folder[0]) && coversFolder(pattern[1:], folder[1:])
+	}
+}
+
+func compileRules(rules PolicyRules) (compiledRules, error) {
+	var compiled compiledRules
+	for _, list := range []struct {
+		patterns []string
+		into     *[]compiledGlob
+	}{{rules.Allow, &compiled.allow}, {rules.Deny, &compiled.deny}} {
+		for _, pattern := range list.patterns {
+			g, err := compileGlob(pattern)
+			if err != nil {
+				return compiledRules{}, err
+			}
+			*list.into = append(*list.into, g)
+		}
+	}
+	return compiled, nil
+}
+
+func compileGlob(pattern string) (compiledGlob, error) {
+	re, err := CompileGlob(pattern)
+	if err != nil {
+		return compiledGlob{}, err
+	}
+	g := compiledGlob{re: re}
+	for _, segment := range strings.Split(strings.Trim(pattern, "/"), "/") {
+		switch {
+		case segment == "**":
+			g.segments = append(g.segments, nil)
+		case strings.Contains(segment, "**"):
+			g.spans = true
+		case segment != "":
+			// A segment without / or ** compiles to a pattern for
+			// that segment alone
+			re, err := CompileGlob(segment)
+			if err != nil {
+				return compiledGlob{}, err
+			}
+			g.segments = append(g.segments, re)
+		}
+	}
+	return g, nil
+}
+
+// CompileGlob converts a glob pattern to an anchored regular expression
+// that ignores case. * and ? match within a path segment, ** matches across
+// segments and "**/" matches any number of folders, including none.
+func CompileGlob(pattern string) (*regexp.Regexp, error) {
+	glob := strings.TrimPrefix(pattern, "/")
+	if glob == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+
+	var re strings.Builder
+	re.WriteString("(?i)^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case strings.HasPrefix(glob[i:], "**/"):
+			// Any number of folders, including none
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		default:
+			r, size := utf8.DecodeRuneInString(glob[i:])
+			re.WriteString(regexp.QuoteMeta(string(r)))
+			i += size - 1
+		}
+	}
+	re.WriteString("$")
+
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	return compiled, nil
+}
@@ -0,0 +1,154 @@
+package security
+
+import "testing"
+
+func TestCompileGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.md", "Todo.md", true},
+		{"*.md", "Inbox/Todo.md", false},
+		{"Daily/*.md", "Daily/2025-01-01.md", true},
+		{"Daily/*.md", "Daily/2025/01-01.md", false},
+		{"Private/**", "Private/a.md", true},
+		{"Private/**", "Private/deep/down/a.md", true},
+		{"Private/**", "Private", false},
+		{"Private/**", "NotPrivate/a.md", false},
+		{"**/*.md", "a.md", true},
+		{"**/*.md", "x/y/a.md", true},
+		{"**/*.md", "x/y/a.png", false},
+		{"**/secret/**", "secret/a.md", true},
+		{"**/secret/**", "a/secret/b/c.md", true},
+		{"**/secret/**", "a/secrets/c.md", false},
+		{"Pro**", "Projects/a.md", true},
+		{"?.md", "a.md", true},
+		{"?.md", "ab.md", false},
+		{"?.md", "é.md", true},
+		{"private/**", "PRIVATE/A.md", true},
+		{"/Inbox/*.md", "Inbox/a.md", true},
+		{"a+b (1).md", "a+b (1).md", true},
+		{"a+b (1).md", "aab 1.md", false},
+	}
+
+	for _, tt := range tests {
+		re, err := CompileGlob(tt.pattern)
+		if err != nil {
+			t.Fatalf("CompileGlob(%q) error = %v", tt.pattern, err)
+		}
+		if got := re.MatchString(tt.path); got != tt.want {
+			t.Errorf("CompileGlob(%q) matches %q = %t, want %t", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+
+	if _, err := CompileGlob("/"); err == nil {
+		t.Error("CompileGlob(\"/\") succeeded, want an error")
+	}
+}
+
+func TestPolicyAllowed(t *testing.T) {
+	config := PolicyConfig{
+		PolicyRules: PolicyRules{Deny: []string{"Private/**"}},
+		Read:        PolicyRules{Allow: []string{"Projects/**", "Private/**", "*.md"}},
+		Write:       PolicyRules{Allow: []string{"Projects/**"}, Deny: []string{"**/Archive/**"}},
+	}
+	policy, err := NewPolicy(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		op   string
+		path string
+		want bool
+	}{
+		{OpRead, "Projects/a.md", true},
+		{OpRead, "/Projects/a.md", true},
+		{OpRead, "projects/A.md", true},
+		{OpRead, "Inbox.md", true},
+		{OpRead, "Inbox/a.md", false},
+		// Deny wins over allow, and the common rules apply to every operation
+		{OpRead, "Private/a.md", false},
+		{OpRead, "Projects/../Private/a.md", false},
+		{OpWrite, "Projects/a.md", true},
+		{OpWrite, "Projects/Archive/a.md", false},
+		{OpWrite, "Inbox.md", false},
+		{OpDelete, "Inbox/a.md", true},
+		{OpDelete, "Private/a.md", false},
+	}
+
+	for _, tt := range tests {
+		if got := policy.Allowed(tt.op, tt.path); got != tt.want {
+			t.Errorf("Allowed(%s, %q) = %t, want %t", tt.op, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyAllowedFolder(t *testing.T) {
+	config := PolicyConfig{
+		PolicyRules: PolicyRules{Deny: []string{"Private/**", "**/.secrets/**", "Drafts/*"}},
+		Read:        PolicyRules{Allow: []string{"Projects/*/Notes/**", "**/*.md", "Pro**"}},
+		Write:       PolicyRules{Allow: []string{"Projects/*/Notes/**"}},
+	}
+	policy, err := NewPolicy(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		op     string
+		folder string
+		want   bool
+	}{
+		{OpRead, "", true},
+		{OpRead, "Inbox", true},
+		{OpRead, "Private", false},
+		{OpRead, "private/Sub", false},
+		{OpRead, "Work/.secrets", false},
+		// Drafts/* denies only the notes directly in Drafts
+		{OpRead, "Drafts", true},
+		{OpWrite, "Projects", true},
+		{OpWrite, "Projects/Site", true},
+		{OpWrite, "Projects/Site/Notes", true},
+		{OpWrite, "Projects/Site/Notes/Old", true},
+		{OpWrite, "Projects/Site/Assets", false},
+		{OpWrite, "Inbox", false},
+		{OpWrite, "Private", false},
+	}
+
+	for _, tt := range tests {
+		if got := policy.AllowedFolder(tt.op, tt.folder); got != tt.want {
+			t.Errorf("AllowedFolder(%s, %q) = %t, want %t", tt.op, tt.folder, got, tt.want)
+		}
+	}
+
+	var none *Policy
+	if !none.Allowed(OpRead, "a.md") || !none.AllowedFolder(OpRead, "a") {
+		t.Error("nil policy denied access")
+	}
+}
+
+func TestPolicyRestricts(t *testing.T) {
+	tests := []struct {
+		config PolicyConfig
+		op     string
+		want   bool
+	}{
+		{PolicyConfig{}, OpRead, false},
+		{PolicyConfig{PolicyRules: PolicyRules{Deny: []string{"Private/**"}}}, OpRead, true},
+		{PolicyConfig{Read: PolicyRules{Allow: []string{"**"}}}, OpRead, true},
+		{PolicyConfig{Write: PolicyRules{Allow: []string{"Inbox/**"}}}, OpRead, false},
+		{PolicyConfig{Write: PolicyRules{Allow: []string{"Inbox/**"}}}, OpWrite, true},
+	}
+
+	for _, tt := range tests {
+		policy, err := NewPolicy(tt.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := policy.Restricts(tt.op); got != tt.want {
+			t.Errorf("Restricts(%s) with %+v = %t, want %t", tt.op, tt.config, got, tt.want)
+		}
+	}
+}
@@ -1,25 +1,29 @@
 package security
 
 import (
+"errors"
 "fmt"
 "strings"
 )
 
+// ErrInvalidPath is returned for paths that are unsafe or not note paths
+var ErrInvalidPath = errors.New("invalid path")
+
 // ValidatePath validates file paths to prevent directory traversal and other attacks
 func ValidatePath(path string) error {
 	// Check for directory traversal attempts
 	if strings.Contains(path, "..") {
-		return fmt.Errorf("invalid path: directory traversal not allowed")
+		return fmt.Errorf("%w: directory traversal not allowed", ErrInvalidPath)
 	}
 
 	// Check for absolute paths
 	if strings.HasPrefix(path, "/") {
-		return fmt.Errorf("invalid path: absolute paths not allowed")
+		return fmt.Errorf("%w: absolute paths not allowed", ErrInvalidPath)
 	}
 
 	// Check for null bytes and other control characters
 	if strings.Contains(path, "\x00") {
-		return fmt.Errorf("invalid path: contains null byte")
+		return fmt.Errorf("%w: contains null byte", ErrInvalidPath)
 	}
 
 	// Check for common dangerous patterns that could cause issues
@@ -27,7 +31,7 @@ func ValidatePath(path string) error {
 	dangerous := []string{"~", "$", "`", "|", ";"}
 for _, d := range dangerous {
 		if strings.Contains(path, d) {
-			return fmt.Errorf("invalid path: contains dangerous character '%s'", d)
+			return fmt.Errorf("%w: contains dangerous character '%s'", ErrInvalidPath, d)
 }
 }
 
@@ -35,7 +39,7 @@ for _, d := range dangerous {
 if !strings.HasSuffix(path, ".md") && !strings.HasSuffix(path, "/") {
 // Allow paths without extension only if they're folder references
 if strings.Contains(path, ".") {
-return fmt.Errorf("invalid path: only .md files are supported")
+return fmt.Errorf("%w: only .md files are supported", ErrInvalidPath)
 }
 }
 
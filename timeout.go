@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"obsidian-mcp/api"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	// defaultRequestTimeout limits each request to the Local REST API
+	defaultRequestTimeout = 30 * time.Second
+	// defaultToolTimeout limits a whole tool call or resource read, which
+	// may make many requests
+	defaultToolTimeout = 2 * time.Minute
+)
+
+// limitDuration returns middleware that cancels tool calls and resource
+// reads after timeout. A call that stops because of the timeout or because
+// the client cancelled it reports that instead of the backend error it
+// caused.
+func limitDuration(timeout time.Duration) mcp.Middleware {
+	return func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			var name string
+			switch r := req.(type) {
+			case *mcp.CallToolRequest:
+				name = "tool " + r.Params.Name
+			case *mcp.ReadResourceRequest:
+				name = "resource " + r.Params.URI
+			default:
+				return next(ctx, method, req)
+			}
+
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+
+			result, err := next(ctx, method, req)
+			if ctx.Err() == nil {
+				return result, err
+			}
+			if res, ok := result.(*mcp.CallToolResult); err == nil && (!ok || !res.IsError) {
+				return result, err
+			}
+
+			reason := fmt.Errorf("%w: %s was cancelled by the client", api.ErrCanceled, name)
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				reason = fmt.Errorf("%w: %s did not finish within %s", api.ErrTimeout, name, timeout)
+			}
+			if _, ok := req.(*mcp.CallToolRequest); ok {
+				return toolError(reason), nil
+			}
+			return nil, reason
+		}
+	}
+}
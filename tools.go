@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// ToolsConfig selects which tools the server offers
+type ToolsConfig struct {
+	ReadOnly bool     `yaml:"read_only"` // only offer tools that don't modify the vault
+	Allow    []string `yaml:"allow"`     // if set, only these tools are offered
+	Deny     []string `yaml:"deny"`      // tools that are never offered
+}
+
+// toolSet registers tools with a server, leaving out tools disabled in the
+// configuration
+type toolSet struct {
+	server *mcp.Server
+	config ToolsConfig
+	// known holds the names of all tools, registered or not
+	known map[string]bool
+	// audit records calls to tools that modify the vault, if set
+	audit *auditLog
+}
+
+func newToolSet(server *mcp.Server, config ToolsConfig, audit *auditLog) *toolSet {
+	return &toolSet{server: server, config: config, known: make(map[string]bool), audit: audit}
+}
+
+// enabled reports whether a tool is offered under the configuration
+func (t *toolSet) enabled(tool *mcp.Tool) bool {
+	readOnly := tool.Annotations != nil && tool.Annotations.ReadOnlyHint
+	switch {
+	case t.config.ReadOnly && !readOnly:
+		return false
+	case len(t.config.Allow) > 0 && !slices.Contains(t.config.Allow, tool.Name):
+		return false
+	default:
+		return !slices.Contains(t.config.Deny, tool.Name)
+	}
+}
+
+// check returns an error for tool names in the allow or deny list that
+// match no tool, so a typo can't leave a tool enabled
+func (t *toolSet) check() error {
+	for _, list := range []struct {
+		key   string
+		names []string
+	}{{"allow", t.config.Allow}, {"deny", t.config.Deny}} {
+		for _, name := range list.names {
+			if !t.known[name] {
+				return fmt.Errorf("tools.%s: unknown tool %q", list.key, name)
+			}
+		}
+	}
+	return nil
+}
+
+// addTool registers a tool with the server unless it is disabled, and
+// records its access level from the ReadOnlyHint annotation, so token
+// scopes can be enforced. Errors returned by the handler are recorded so
+// their code can be reported, and calls to tools that modify the vault are
+// written to the audit log.
+func addTool[In, Out any](tools *toolSet, tool *mcp.Tool, handler mcp.ToolHandlerFor[In, Out]) {
+	tools.known[tool.Name] = true
+	if !tools.enabled(tool) {
+		return
+	}
+
+	readOnly := tool.Annotations != nil && tool.Annotations.ReadOnlyHint
+	toolAccess[tool.Name] = readOnly
+	audit := tools.audit
+	if readOnly {
+		audit = nil
+	}
+	mcp.AddTool(tools.server, tool, func(ctx context.Context, req *mcp.CallToolRequest, input In) (*mcp.CallToolResult, Out, error) {
+		var record *auditRecord
+		if audit != nil {
+			record = audit.begin(ctx, req, input)
+			ctx = context.WithValue(ctx, auditKey, record)
+		}
+
+		result, output, err := handler(ctx, req, input)
+		if err != nil {
+			recordToolError(ctx, err)
+		}
+		if record != nil {
+			audit.end(ctx, record, err)
+		}
+		return result, output, err
+	})
+}
+
+// toolNames parses a comma-separated list of tool names
+func toolNames(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Supported transports
+const (
+	transportStdio = "stdio"
+	transportHTTP  = "http"
+	transportSSE   = "sse"
+)
+
+// Endpoints used by the HTTP based transports
+const (
+	streamableEndpoint = "/mcp"
+	sseEndpoint        = "/sse"
+)
+
+// shutdownTimeout bounds how long in-flight HTTP requests may take to finish
+const shutdownTimeout = 10 * time.Second
+
+// runServer runs the MCP server over the transport selected in the config.
+// It returns when ctx is cancelled or the transport fails.
+func runServer(ctx context.Context, server *mcp.Server, config Config) error {
+	switch config.Server.Transport {
+	case "", transportStdio:
+		log.Println("Starting Obsidian MCP Server with stdio transport...")
+		err := server.Run(ctx, &mcp.StdioTransport{})
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return err
+	case transportHTTP:
+		handler := mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return server }, nil)
+		return serveHTTP(ctx, streamableEndpoint, handler, config)
+	case transportSSE:
+		handler := mcp.NewSSEHandler(func(*http.Request) *mcp.Server { return server }, nil)
+		return serveHTTP(ctx, sseEndpoint, handler, config)
+	default:
+		return fmt.Errorf("unknown transport %q (expected %s, %s or %s)",
+			config.Server.Transport, transportStdio, transportHTTP, transportSSE)
+	}
+}
+
+// serveHTTP serves handler on endpoint behind the auth layer until ctx is
+// cancelled, then shuts the listener down gracefully.
+func serveHTTP(ctx context.Context, endpoint string, handler http.Handler, config Config) error {
+	handler, err := withAuth(handler, config)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(endpoint, handler)
+
+	httpServer := &http.Server{
+		Addr:              config.Server.Address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		// Request contexts derive from ctx so tool handlers can reach the
+		// values stored in it, and long-lived streams end on shutdown.
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	useTLS := config.Server.TLSCert != "" || config.Server.TLSKey != ""
+	if useTLS && (config.Server.TLSCert == "" || config.Server.TLSKey == "") {
+		return fmt.Errorf("both tls_cert and tls_key must be set to enable TLS")
+	}
+
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	log.Printf("Starting Obsidian MCP Server with %s transport on %s://%s%s...", config.Server.Transport, scheme, config.Server.Address, endpoint)
+
+	errCh := make(chan error, 1)
+	go func() {
+		if useTLS {
+			errCh <- httpServer.ListenAndServeTLS(config.Server.TLSCert, config.Server.TLSKey)
+			return
+		}
+		errCh <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Println("Shutting down HTTP server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down HTTP server: %v", err)
+	}
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
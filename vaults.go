@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"obsidian-mcp/api"
+	"obsidian-mcp/security"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// defaultVaultName names the vault built from the single-vault settings
+const defaultVaultName = "default"
+
+// VaultConfig configures one named vault
+type VaultConfig struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Backend     string `yaml:"backend"`  // rest or filesystem
+	BaseURL     string `yaml:"base_url"` // Local REST API URL for the rest backend
+	Token       string `yaml:"token"`    // Local REST API token for the rest backend
+	Path        string `yaml:"path"`     // vault directory for the filesystem backend
+	// TrashFolder is where delete_note moves notes, vault.trash_folder by default
+	TrashFolder string `yaml:"trash_folder"`
+	// Timeout limits each Local REST API request of the rest backend
+	Timeout time.Duration `yaml:"timeout"`
+	// Retry overrides the obsidian_api retry settings for the rest backend
+	Retry *RetryConfig `yaml:"retry"`
+	// TLS overrides the obsidian_api certificate settings for the rest backend
+	TLS *TLSConfig `yaml:"tls"`
+}
+
+// RetryConfig configures retries and the circuit breaker of the REST client
+type RetryConfig struct {
+	MaxRetries       int           `yaml:"max_retries"` // for GET, PUT and DELETE
+	BaseDelay        time.Duration `yaml:"base_delay"`
+	MaxDelay         time.Duration `yaml:"max_delay"`
+	BreakerThreshold int           `yaml:"breaker_threshold"` // consecutive failures, 0 disables
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`
+}
+
+// TLSConfig configures how the REST client verifies the certificate of the
+// Local REST API's HTTPS port, which is self-signed by the plugin
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file"`              // PEM bundle to trust, e.g. the plugin's certificate
+	Fingerprint        string `yaml:"fingerprint"`          // SHA-256 of the certificate, hex with or without colons
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"` // accept any certificate
+}
+
+// vaultRegistry holds the backends of all configured vaults
+type vaultRegistry struct {
+	configs      []VaultConfig
+	backends     map[string]api.VaultBackend
+	defaultVault string
+	// policy limits which paths tools may read, write and delete
+	policy *security.Policy
+	// writes serializes tool calls that write the same note
+	writes noteLocks
+}
+
+// noteLocks holds a lock per note, so checking a note's version and
+// writing it can't interleave with another write to the same note
+type noteLocks struct {
+	mu    sync.Mutex
+	locks map[string]*noteLock
+}
+
+// noteLock is the lock of one note and the number of callers holding or
+// waiting for it
+type noteLock struct {
+	sync.Mutex
+	users int
+}
+
+// lock locks a note and returns the function that unlocks it
+func (l *noteLocks) lock(key string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*noteLock)
+	}
+	nl, ok := l.locks[key]
+	if !ok {
+		nl = &noteLock{}
+		l.locks[key] = nl
+	}
+	nl.users++
+	l.mu.Unlock()
+
+	nl.Lock()
+	return func() {
+		nl.Unlock()
+		l.mu.Lock()
+		if nl.users--; nl.users == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// vaultConfigs returns the configured vaults. When no vaults list is given,
+// a single vault is built from the obsidian_api and vault sections.
+func vaultConfigs(config Config) []VaultConfig {
+	if len(config.Vaults) > 0 {
+		vaults := make([]VaultConfig, len(config.Vaults))
+		for i, vc := range config.Vaults {
+			// Client settings not given for a vault come from obsidian_api
+			if vc.Timeout == 0 {
+				vc.Timeout = config.ObsidianAPI.Timeout
+			}
+			if vc.Retry == nil {
+				vc.Retry = &config.ObsidianAPI.Retry
+			}
+			if vc.TLS == nil {
+				vc.TLS = &config.ObsidianAPI.TLS
+			}
+			if vc.TrashFolder == "" {
+				vc.TrashFolder = config.Vault.TrashFolder
+			}
+			vaults[i] = vc
+		}
+		return vaults
+	}
+	return []VaultConfig{{
+		Name:        defaultVaultName,
+		Backend:     config.Vault.Backend,
+		BaseURL:     config.ObsidianAPI.BaseURL,
+		Token:       config.ObsidianAPI.Token,
+		Path:        config.Vault.Path,
+		Timeout:     config.ObsidianAPI.Timeout,
+		Retry:       &config.ObsidianAPI.Retry,
+		TLS:         &config.ObsidianAPI.TLS,
+		TrashFolder: config.Vault.TrashFolder,
+	}}
+}
+
+// newVaultBackend creates the backend selected in a vault config
+func newVaultBackend(vc VaultConfig) (api.VaultBackend, error) {
+	switch vc.Backend {
+	case "", api.BackendREST:
+		baseURL := vc.BaseURL
+		if baseURL == "" {
+			baseURL = defaultBaseURL
+		}
+		opts := api.ClientOptions{Timeout: vc.Timeout}
+		if opts.Timeout == 0 {
+			opts.Timeout = defaultRequestTimeout
+		}
+		if vc.Retry != nil {
+			opts.MaxRetries = vc.Retry.MaxRetries
+			opts.RetryBaseDelay = vc.Retry.BaseDelay
+			opts.RetryMaxDelay = vc.Retry.MaxDelay
+			opts.BreakerThreshold = vc.Retry.BreakerThreshold
+			opts.BreakerCooldown = vc.Retry.BreakerCooldown
+		}
+		if vc.TLS != nil {
+			opts.CACertFile = vc.TLS.CAFile
+			opts.CertFingerprint = vc.TLS.Fingerprint
+			opts.InsecureSkipVerify = vc.TLS.InsecureSkipVerify
+			if opts.InsecureSkipVerify {
+				log.Printf("Warning: TLS certificate verification is disabled for vault %q", vc.Name)
+			}
+		}
+		return api.NewObsidianAPI(baseURL, vc.Token, opts)
+	case api.BackendFileSystem:
+		return api.NewFileSystemVault(vc.Path)
+	default:
+		return nil, fmt.Errorf("unknown vault backend %q (expected %s or %s)", vc.Backend, api.BackendREST, api.BackendFileSystem)
+	}
+}
+
+// newVaultRegistry creates backends for every configured vault
+func newVaultRegistry(config Config) (*vaultRegistry, error) {
+	registry := &vaultRegistry{
+		configs:  vaultConfigs(config),
+		backends: make(map[string]api.VaultBackend),
+	}
+
+	for _, vc := range registry.configs {
+		if vc.Name == "" {
+			return nil, fmt.Errorf("every vault needs a name")
+		}
+		if _, exists := registry.backends[vc.Name]; exists {
+			return nil, fmt.Errorf("duplicate vault name %q", vc.Name)
+		}
+		backend, err := newVaultBackend(vc)
+		if err != nil {
+			return nil, fmt.Errorf("vault %q: %v", vc.Name, err)
+		}
+		if config.Search.Index {
+			backend = api.NewIndexedVault(backend, vc.Name, indexFile(config.Search.IndexDir, vc))
+		}
+		registry.backends[vc.Name] = backend
+	}
+
+	policy, err := security.NewPolicy(config.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("policy: %v", err)
+	}
+	registry.policy = policy
+
+	registry.defaultVault = config.DefaultVault
+	if registry.defaultVault == "" {
+		registry.defaultVault = registry.configs[0].Name
+	}
+	if _, ok := registry.backends[registry.defaultVault]; !ok {
+		return nil, fmt.Errorf("default vault %q is not configured", registry.defaultVault)
+	}
+
+	return registry, nil
+}
+
+// indexFile returns where the search index of a vault is saved: in dir, or
+// the user cache directory by default, under a name made from the vault's
+// name and location. It returns "" when there is no cache directory.
+func indexFile(dir string, vc VaultConfig) string {
+	if dir == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(cache, "obsidian-mcp")
+	}
+	location := vc.BaseURL
+	if vc.Backend == api.BackendFileSystem {
+		location, _ = filepath.Abs(vc.Path)
+	}
+	sum := sha256.Sum256([]byte(vc.Backend + "\x00" + location))
+	return filepath.Join(dir, fmt.Sprintf("%s-%x.index", url.PathEscape(vc.Name), sum[:4]))
+}
+
+// buildIndexes builds the search index of every vault in the background
+func (r *vaultRegistry) buildIndexes(ctx context.Context) {
+	for _, backend := range r.backends {
+		if indexed, ok := backend.(*api.IndexedVault); ok {
+			go indexed.Build(ctx)
+		}
+	}
+}
+
+// saveIndexes saves the search indexes that changed since they were last
+// saved
+func (r *vaultRegistry) saveIndexes() {
+	for name, backend := range r.backends {
+		if indexed, ok := backend.(*api.IndexedVault); ok {
+			if err := indexed.Save(); err != nil {
+				log.Printf("Warning: failed to save search index of vault %q: %v", name, err)
+			}
+		}
+	}
+}
+
+// resolve returns name, or the default vault's name when name is empty
+func (r *vaultRegistry) resolve(name string) string {
+	if name == "" {
+		return r.defaultVault
+	}
+	return name
+}
+
+// get returns the backend for the named vault, or the default vault when
+// name is empty
+func (r *vaultRegistry) get(name string) (api.VaultBackend, error) {
+	name = r.resolve(name)
+	backend, ok := r.backends[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown vault %q (available: %s)", name, strings.Join(r.names(), ", "))
+	}
+	return backend, nil
+}
+
+// trashFolder returns the trash folder of the named vault, or of the
+// default vault when name is empty
+func (r *vaultRegistry) trashFolder(name string) string {
+	name = r.resolve(name)
+	for _, vc := range r.configs {
+		if vc.Name == name && vc.TrashFolder != "" {
+			return strings.Trim(vc.TrashFolder, "/")
+		}
+	}
+	return api.DefaultTrashFolder
+}
+
+// lockNote locks a note of the named vault, or of the default vault when
+// name is empty, against writes by other tool calls and returns the
+// function that unlocks it. Edits made in Obsidian aren't held off.
+func (r *vaultRegistry) lockNote(name, notePath string) func() {
+	notePath = path.Clean("/" + api.NormalizeNotePath(notePath))
+	return r.writes.lock(r.resolve(name) + ":" + notePath)
+}
+
+// lockMoves serializes moves in the named vault, or in the default vault
+// when name is empty, and returns the function that ends the move. A move
+// holds its source and destination while it locks each note whose links
+// it rewrites, so two moves at once could each wait for the other.
+func (r *vaultRegistry) lockMoves(name string) func() {
+	return r.writes.lock(r.resolve(name) + "\x00moves")
+}
+
+// names returns the vault names in configuration order
+func (r *vaultRegistry) names() []string {
+	names := make([]string, len(r.configs))
+	for i, vc := range r.configs {
+		names[i] = vc.Name
+	}
+	return names
+}
+
+// vaultFromContext returns the backend for the named vault from the
+// registry stored in ctx
+func vaultFromContext(ctx context.Context, name string) (api.VaultBackend, error) {
+	return ctx.Value(vaultsKey).(*vaultRegistry).get(name)
+}
+
+// lockNote serializes writes to a note through this server and returns
+// the function that releases it. Holding it while checking a version and
+// writing stops two tool calls from both passing the check, but it is no
+// compare-and-swap against Obsidian: an edit made there in between is
+// overwritten.
+func lockNote(ctx context.Context, vaultName, notePath string) func() {
+	return ctx.Value(vaultsKey).(*vaultRegistry).lockNote(vaultName, notePath)
+}
+
+// lockNotes locks several notes of a vault in path order, so calls locking
+// some of the same notes can't deadlock, and returns the function that
+// unlocks them
+func lockNotes(ctx context.Context, vaultName string, notePaths ...string) func() {
+	keys := make([]string, 0, len(notePaths))
+	for _, notePath := range notePaths {
+		keys = append(keys, path.Clean("/"+api.NormalizeNotePath(notePath)))
+	}
+	sort.Strings(keys)
+	keys = slices.Compact(keys)
+
+	unlocks := make([]func(), 0, len(keys))
+	for _, key := range keys {
+		unlocks = append(unlocks, lockNote(ctx, vaultName, key))
+	}
+	return func() {
+		for _, unlock := range slices.Backward(unlocks) {
+			unlock()
+		}
+	}
+}
+
+// checkPolicy returns an error if the access policy does not allow an
+// operation on a note of the named vault. A note in the trash must also be
+// allowed where it was deleted from.
+func checkPolicy(ctx context.Context, vaultName, op, notePath string) error {
+	registry := ctx.Value(vaultsKey).(*vaultRegistry)
+	notePath = api.NormalizeNotePath(notePath)
+	if err := registry.policy.Check(op, notePath); err != nil || registry.policy == nil {
+		return err
+	}
+
+	folder := registry.trashFolder(vaultName)
+	cleaned := strings.TrimPrefix(path.Clean("/"+notePath), "/")
+	if !api.InTrash(cleaned, folder) {
+		return nil
+	}
+	vault, err := registry.get(vaultName)
+	if err != nil {
+		return err
+	}
+	origin, err := api.TrashOrigin(ctx, vault, folder, cleaned)
+	if err != nil {
+		return fmt.Errorf("failed to check where %s was deleted from: %w", notePath, err)
+	}
+	if origin != "" && !registry.policy.Allowed(op, origin) {
+		// Name the note by its path in the trash, not where it came from
+		return fmt.Errorf("%w: policy does not allow %s on %s", security.ErrDenied, op, notePath)
+	}
+	return nil
+}
+
+// allowedNotes returns the notes, given relative to folder, that the
+// access policy allows reading
+func allowedNotes(policy *security.Policy, folder string, notes []string) []string {
+	if policy == nil {
+		return notes
+	}
+	allowed := make([]string, 0, len(notes))
+	for _, note := range notes {
+		if policy.Allowed(security.OpRead, path.Join(folder, note)) {
+			allowed = append(allowed, note)
+		}
+	}
+	return allowed
+}
+
+type ListVaultsInput struct {
+	// No parameters needed
+}
+
+type VaultSummary struct {
+	Name        string `json:"name" jsonschema:"description:Vault name to pass as the vault parameter"`
+	Description string `json:"description,omitempty" jsonschema:"description:Vault description"`
+	Backend     string `json:"backend" jsonschema:"description:Backend used to access the vault"`
+	Default     bool   `json:"default" jsonschema:"description:Whether tools use this vault when no vault is given"`
+}
+
+type VaultsListOutput struct {
+	Vaults []VaultSummary `json:"vaults" jsonschema:"description:Configured vaults"`
+}
+
+func ListVaults(ctx context.Context, req *mcp.CallToolRequest, input ListVaultsInput) (*mcp.CallToolResult, VaultsListOutput, error) {
+	registry := ctx.Value(vaultsKey).(*vaultRegistry)
+
+	output := VaultsListOutput{Vaults: []VaultSummary{}}
+	for _, vc := range registry.configs {
+		backend := vc.Backend
+		if backend == "" {
+			backend = api.BackendREST
+		}
+		output.Vaults = append(output.Vaults, VaultSummary{
+			Name:        vc.Name,
+			Description: vc.Description,
+			Backend:     backend,
+			Default:     vc.Name == registry.defaultVault,
+		})
+	}
+
+	return nil, output, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockNote(t *testing.T) {
+	registry := &vaultRegistry{defaultVault: "default"}
+
+	// The default vault, a missing extension and a leading slash name the
+	// same note
+	unlock := registry.lockNote("", "Inbox/Todo")
+	locked := make(chan struct{})
+	go func() {
+		defer registry.lockNote("default", "/Inbox/Todo.md")()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("second lock acquired while the note was locked")
+	case <-time.After(20 * time.Millisecond):
+	}
+	// Other notes and vaults aren't held up
+	registry.lockNote("", "Inbox/Other.md")()
+	registry.lockNote("work", "Inbox/Todo.md")()
+	unlock()
+	<-locked
+
+	var wg sync.WaitGroup
+	counter := 0
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer registry.lockNote("", "a.md")()
+			counter++
+		}()
+	}
+	wg.Wait()
+	if counter != 50 {
+		t.Errorf("counter = %d, want 50", counter)
+	}
+	if n := len(registry.writes.locks); n != 0 {
+		t.Errorf("%d locks left after all were released", n)
+	}
+}
+
+func TestLockNotes(t *testing.T) {
+	registry := &vaultRegistry{defaultVault: "default"}
+	ctx := context.WithValue(context.Background(), vaultsKey, registry)
+
+	// Two names for one note are locked once, and notes locked in opposite
+	// orders don't deadlock
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if i%2 == 0 {
+				defer lockNotes(ctx, "", "A", "/A.md", "B.md")()
+			} else {
+				defer lockNotes(ctx, "", "B.md", "A.md")()
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(registry.writes.locks); n != 0 {
+		t.Errorf("%d locks left after all were released", n)
+	}
+}